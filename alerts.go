@@ -0,0 +1,136 @@
+package noaa
+
+import (
+	"strings"
+	"time"
+)
+
+// Severity is the CAP severity of an alert, the expected impact of the event.
+type Severity string
+
+// Severities in order from the most to the least severe.
+const (
+	SeverityExtreme  Severity = "Extreme"
+	SeveritySevere   Severity = "Severe"
+	SeverityModerate Severity = "Moderate"
+	SeverityMinor    Severity = "Minor"
+	SeverityUnknown  Severity = "Unknown"
+)
+
+// Urgency is the CAP urgency of an alert, how soon action should be taken.
+type Urgency string
+
+// Urgencies in order from the most to the least urgent.
+const (
+	UrgencyImmediate Urgency = "Immediate"
+	UrgencyExpected  Urgency = "Expected"
+	UrgencyFuture    Urgency = "Future"
+	UrgencyPast      Urgency = "Past"
+	UrgencyUnknown   Urgency = "Unknown"
+)
+
+// Certainty is the CAP certainty of an alert, how likely the event is.
+type Certainty string
+
+// Certainties in order from the most to the least certain.
+const (
+	CertaintyObserved Certainty = "Observed"
+	CertaintyLikely   Certainty = "Likely"
+	CertaintyPossible Certainty = "Possible"
+	CertaintyUnlikely Certainty = "Unlikely"
+	CertaintyUnknown  Certainty = "Unknown"
+)
+
+// Ranks of the known values, higher is more severe, urgent, or certain. Any
+// other value, including Unknown, ranks lowest.
+var (
+	severityRank  = map[Severity]int{SeverityMinor: 1, SeverityModerate: 2, SeveritySevere: 3, SeverityExtreme: 4}
+	urgencyRank   = map[Urgency]int{UrgencyPast: 1, UrgencyFuture: 2, UrgencyExpected: 3, UrgencyImmediate: 4}
+	certaintyRank = map[Certainty]int{CertaintyUnlikely: 1, CertaintyPossible: 2, CertaintyLikely: 3, CertaintyObserved: 4}
+)
+
+// AtLeast reports whether s is as severe as other or more, for example
+// alert.Severity.AtLeast(SeveritySevere) for severe and extreme alerts.
+func (s Severity) AtLeast(other Severity) bool {
+	return severityRank[s] >= severityRank[other]
+}
+
+// AtLeast reports whether u is as urgent as other or more.
+func (u Urgency) AtLeast(other Urgency) bool {
+	return urgencyRank[u] >= urgencyRank[other]
+}
+
+// AtLeast reports whether c is as certain as other or more.
+func (c Certainty) AtLeast(other Certainty) bool {
+	return certaintyRank[c] >= certaintyRank[other]
+}
+
+// DedupeByEvent merges alerts for the same event and severity whose effective
+// to expires windows overlap, such as the same advisory issued for adjacent
+// zones. The areas and affected zones of merged alerts are combined and the
+// widest window is kept; the other fields are those of the first alert. Alerts
+// with times that can not be parsed are never merged. The order of the first
+// alert of each group is preserved.
+func (r *AlertsResponse) DedupeByEvent() []Alert {
+	type window struct{ start, end time.Time }
+	merged := []Alert{}
+	windows := []window{}
+	for _, alert := range r.Alerts {
+		effective, err1 := time.Parse(time.RFC3339, alert.Effective)
+		expires, err2 := time.Parse(time.RFC3339, alert.Expires)
+		if err1 != nil || err2 != nil {
+			merged = append(merged, alert)
+			windows = append(windows, window{})
+			continue
+		}
+		i := 0
+		for ; i < len(merged); i++ {
+			m, w := merged[i], windows[i]
+			if m.Event == alert.Event && m.Severity == alert.Severity && !w.start.IsZero() &&
+				!effective.After(w.end) && !expires.Before(w.start) {
+				break
+			}
+		}
+		if i == len(merged) {
+			alert.AffectedZones = append([]string(nil), alert.AffectedZones...)
+			merged = append(merged, alert)
+			windows = append(windows, window{effective, expires})
+			continue
+		}
+		m := &merged[i]
+		m.AreaDesc = mergeList(m.AreaDesc, alert.AreaDesc)
+		for _, zone := range alert.AffectedZones {
+			if !contains(m.AffectedZones, zone) {
+				m.AffectedZones = append(m.AffectedZones, zone)
+			}
+		}
+		if effective.Before(windows[i].start) {
+			windows[i].start, m.Effective = effective, alert.Effective
+		}
+		if expires.After(windows[i].end) {
+			windows[i].end, m.Expires = expires, alert.Expires
+		}
+	}
+	return merged
+}
+
+// mergeList adds the items of the "; " separated list b, such as an areaDesc,
+// that are not already in a.
+func mergeList(a, b string) string {
+	items := strings.Split(a, "; ")
+	for _, item := range strings.Split(b, "; ") {
+		if item != "" && !contains(items, item) {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, "; ")
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
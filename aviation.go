@@ -0,0 +1,71 @@
+package noaa
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CWSU returns the details of a Center Weather Service Unit identified by the
+// ID of its Air Route Traffic Control Center, for example "ZAU" for Chicago.
+func CWSU(id string) (cwsu *CWSUResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	err = decode(ctx, configFrom(ctx).endpointCWSU(id), &cwsu)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// CWAs returns the Center Weather Advisories issued by the Center Weather
+// Service Unit identified by cwsuID, for example "ZAU". Advisories describe
+// conditions hazardous to aviation for the next few hours.
+func CWAs(cwsuID string) (cwas *CWAsResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	err = decode(ctx, configFrom(ctx).endpointCWAs(cwsuID), &cwas)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// SIGMETQuery filters the SIGMETs returned by SIGMETs. Zero fields are ignored.
+type SIGMETQuery struct {
+	Start time.Time // SIGMETs valid at or after Start
+	End   time.Time // SIGMETs valid at or before End
+	Date  time.Time // SIGMETs issued on the (UTC) date of Date
+	ATSU  string    // air traffic service unit, e.g. "KKCI"
+}
+
+// values returns the query parameters of q for the /aviation/sigmets endpoint.
+func (q SIGMETQuery) values() url.Values {
+	params := url.Values{}
+	if !q.Start.IsZero() {
+		params.Set("start", q.Start.UTC().Format(time.RFC3339))
+	}
+	if !q.End.IsZero() {
+		params.Set("end", q.End.UTC().Format(time.RFC3339))
+	}
+	if !q.Date.IsZero() {
+		params.Set("date", q.Date.UTC().Format("2006-01-02"))
+	}
+	if q.ATSU != "" {
+		params.Set("atsu", strings.ToUpper(q.ATSU))
+	}
+	return params
+}
+
+// SIGMETs returns the significant meteorological information (SIGMET)
+// advisories for aviation matching q. The pages of the response are combined,
+// see SetMaxPages.
+func SIGMETs(q SIGMETQuery) (sigmets *SIGMETsResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	endpoint, err := withQuery(configFrom(ctx).endpointSIGMETs(), q.values())
+	if err != nil {
+		return nil, err
+	}
+	return decodePages[SIGMETsResponse](ctx, endpoint, 1)
+}
@@ -0,0 +1,85 @@
+package noaa
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Location identifies a point by <lat,lon> for the batch functions.
+type Location struct {
+	Lat string
+	Lon string
+}
+
+// ErrBatchStopped is the error of the locations of a batch that were not
+// fetched because another location failed, see WithStopOnFirstError.
+var ErrBatchStopped = errors.New("batch stopped after an error")
+
+const maxConcurrentForecasts = 8
+
+// ForecastBatch returns the forecasts for several locations, fetched
+// concurrently, keyed by location. A snapshot of the config is taken once when
+// the batch starts and used for every request, so calls such as SetUnits made
+// while the batch runs do not affect it and all of the forecasts are in the
+// same units. The options are applied to every request. A location listed more
+// than once is fetched once.
+//
+// Every location is either in forecasts or in errs. A location that fails does
+// not affect the others: its error is in errs and the other locations have
+// their forecasts. With WithStopOnFirstError(true) the batch instead stops at
+// the first error; the locations that were not fetched, or whose requests were
+// canceled, then have ErrBatchStopped while those that completed keep their
+// forecasts.
+func ForecastBatch(ctx context.Context, locations []Location, opts ...Option) (forecasts map[Location]*ForecastResponse, errs map[Location]error) {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ctx, _ = callConfig(ctx)
+	batchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	forecasts = make(map[Location]*ForecastResponse, len(locations))
+	errs = make(map[Location]error)
+	fetched := make(map[Location]bool, len(locations))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, maxConcurrentForecasts)
+	for _, location := range locations {
+		if fetched[location] {
+			continue
+		}
+		fetched[location] = true
+		wg.Add(1)
+		go func(location Location) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			if batchCtx.Err() != nil && ctx.Err() == nil {
+				mu.Lock()
+				errs[location] = ErrBatchStopped
+				mu.Unlock()
+				return
+			}
+			forecast, err := ForecastContext(batchCtx, location.Lat, location.Lon, opts...)
+			if err != nil && o.stopOnFirstError {
+				if batchCtx.Err() != nil && ctx.Err() == nil && errors.Is(err, context.Canceled) {
+					err = ErrBatchStopped
+				} else {
+					stop()
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[location] = err
+				return
+			}
+			forecasts[location] = forecast
+		}(location)
+	}
+	wg.Wait()
+	return forecasts, errs
+}
@@ -1,15 +1,27 @@
 package noaa
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // deprecated
 // Default values for the weather.gov REST API config which will
 // be replaced by Config. These are subject to deletion in the future.
 // Instead, use noaa.GetConfig followed by:
-//     Config.BaseURL, Config.UserAgent, Config.Accept
+//
+//	Config.BaseURL, Config.UserAgent, Config.Accept
 const (
 	API       = "https://api.weather.gov"
 	APIKey    = "github.com/icodealot/noaa" // User-Agent default value
@@ -19,6 +31,61 @@ const (
 // Config instance for the API calls executed by the NOAA client.
 var config = GetDefaultConfig()
 
+// configMu guards config. It is only written by the Set* functions; calls read
+// a snapshot of it taken once per call, see callConfig, so that the package can
+// be used concurrently with Set* calls.
+var configMu sync.RWMutex
+
+type configKey struct{}
+
+// snapshotConfig returns a copy of the config, e.g. for the requests of a batch
+// so that Set* calls made while the batch runs do not affect it. The client is
+// resolved up front so that the snapshot is never modified by the requests.
+func snapshotConfig() *Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	c := config
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	return &c
+}
+
+// defaultContext returns the context for the requests of a call that has no
+// context argument, with the deadline set with SetDefaultTimeout, if any. The
+// context carries a snapshot of the config, see callConfig.
+func defaultContext() (context.Context, context.CancelFunc) {
+	ctx, cfg := callConfig(context.Background())
+	if cfg.DefaultTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, cfg.DefaultTimeout)
+}
+
+// withConfig returns ctx carrying the config c to be used for its requests.
+func withConfig(ctx context.Context, c *Config) context.Context {
+	return context.WithValue(ctx, configKey{}, c)
+}
+
+// callConfig returns the config of a call and ctx carrying it. The config of
+// ctx is kept if it has one, otherwise a snapshot is taken, so that every
+// request of the call uses the same config and none of them reads config while
+// a Set* call modifies it.
+func callConfig(ctx context.Context) (context.Context, *Config) {
+	if c, ok := ctx.Value(configKey{}).(*Config); ok {
+		return ctx, c
+	}
+	c := snapshotConfig()
+	return withConfig(ctx, c), c
+}
+
+// configFrom returns the config carried by ctx, see callConfig, or else a
+// snapshot of the current config.
+func configFrom(ctx context.Context) *Config {
+	_, c := callConfig(ctx)
+	return c
+}
+
 // Config describes important values for the NOAA API and allows for
 // configuration and testing of various options. Note, the User-Agent
 // field of HTTP requests serves as a proxy for an API key and in the
@@ -29,62 +96,655 @@ type Config struct {
 	UserAgent string `json:"apiKey"`  // ex. (myweatherapp.com, contact@myweatherapp.com)
 	Accept    string `json:"accept"`  // application/geo+json, etc. defaults to ld+json
 	Units     string `json:"units"`   // "us" (the default if blank) or "si" for metric
+
+	// PathPrefix is added between BaseURL and the path of every endpoint, e.g.
+	// "/v2" to adopt a versioned API. It is blank for the current API.
+	PathPrefix string `json:"pathPrefix"`
+
+	// AcceptLanguage is sent as the Accept-Language header, e.g. "es-US" for
+	// products available in Spanish. The header is omitted if blank.
+	AcceptLanguage string `json:"acceptLanguage"`
+
+	// StrictCoordinates rejects a blank or zero lat, lon with
+	// ErrInvalidCoordinates instead of requesting it from the API, which
+	// returns a 404. See SetStrictCoordinates.
+	StrictCoordinates bool `json:"strictCoordinates"`
+
+	// DisableQuantitativeValues stops the client from requesting quantitative
+	// values (QV) for forecasts. See SetQuantitativeValues.
+	DisableQuantitativeValues bool `json:"disableQuantitativeValues"`
+
+	// Retries is the number of times a request is retried after a network
+	// error, a 429, or a 5xx response. Each retry waits twice as long as the
+	// previous one, starting with RetryDelay.
+	Retries    int           `json:"retries"`
+	RetryDelay time.Duration `json:"retryDelay"`
+
+	// RetryJitter waits a random delay between zero and the computed backoff
+	// before each retry so that concurrent callers do not retry in lockstep.
+	RetryJitter bool `json:"retryJitter"`
+
+	// CircuitThreshold is the number of consecutive failed requests after
+	// which requests fail fast with ErrCircuitOpen for CircuitCooldown. Zero
+	// disables the circuit breaker. See SetCircuitBreaker.
+	CircuitThreshold int           `json:"circuitThreshold"`
+	CircuitCooldown  time.Duration `json:"circuitCooldown"`
+
+	// DefaultTimeout bounds the total time of each call without a context
+	// argument, including retries and the point lookup. Zero means no limit.
+	// See SetDefaultTimeout.
+	DefaultTimeout time.Duration `json:"defaultTimeout"`
+
+	// MaxResponseBytes limits the size of response bodies that are decoded.
+	// DefaultMaxResponseBytes is used if zero.
+	MaxResponseBytes int64 `json:"maxResponseBytes"`
+
+	// PrecipThreshold is the probability of precipitation, as a percent, at
+	// or above which precipitation is expected by HourlyForecastResponse's
+	// NextChange. DefaultPrecipThreshold is used if zero.
+	PrecipThreshold float64 `json:"precipThreshold"`
+
+	// MaxPages is the number of pages that paginated endpoints such as
+	// Observations follow. Only the first page is returned if zero or one,
+	// except by Alerts which follows every page if zero. See SetMaxPages.
+	MaxPages int `json:"maxPages"`
+
+	// NegativeCacheTTL is how long a point lookup that returned a 404 is
+	// remembered. See SetNegativeCacheTTL.
+	NegativeCacheTTL time.Duration `json:"negativeCacheTTL"`
+
+	// ForecastCacheTTL is how long an hourly forecast is cached, but never
+	// beyond the end of its ValidTimes. See SetForecastCacheTTL.
+	ForecastCacheTTL time.Duration `json:"forecastCacheTTL"`
+
+	// DisableAcceptFallback stops the client from retrying a request as
+	// application/ld+json when a response in the Accept format fails to
+	// decode or is not acceptable. See SetAcceptFallback.
+	DisableAcceptFallback bool `json:"disableAcceptFallback"`
+
+	// DisableRedirects stops the client from following redirects so that they
+	// are returned as an *APIError instead. See SetFollowRedirects. Only
+	// applies when Client is an *http.Client.
+	DisableRedirects bool `json:"disableRedirects"`
+
+	// ExtraHeaders are added to every request, e.g. for proxies or gateways.
+	ExtraHeaders map[string]string `json:"extraHeaders"`
+
+	// StrictDecoding makes decoding fail on fields of a response that are not
+	// in the response type. See SetStrictDecoding.
+	StrictDecoding bool `json:"strictDecoding"`
+
+	// Debug records the last raw response of each endpoint. See SetDebug.
+	Debug bool `json:"debug"`
+
+	Client Doer        `json:"-"` // defaults to http.DefaultClient if nil
+	Logger *log.Logger `json:"-"` // warnings are discarded if nil
+
+	// OnResponse is called after each request, including retries, with the
+	// endpoint, the status code (0 for network errors), the number of bytes
+	// of the body that were read, and the duration until the body was closed.
+	// See SetOnResponse.
+	OnResponse func(endpoint string, status int, bytes int, dur time.Duration) `json:"-"`
 }
 
+// DefaultMaxResponseBytes is the default limit for the size of a response body.
+// The largest responses, such as gridpoint forecasts, are well under this.
+const DefaultMaxResponseBytes = 16 << 20
+
+// DefaultPrecipThreshold is the default probability of precipitation, as a
+// percent, at or above which precipitation is expected.
+const DefaultPrecipThreshold = 50
+
+// Errors returned when attempting to set invalid configuration values.
+var (
+	ErrInvalidConfig    = errors.New("invalid configuration")
+	ErrMissingUserAgent = errors.New("the api requires a user-agent")
+	ErrMissingBaseURL   = errors.New("the api requires a base url")
+	ErrMissingAccept    = errors.New("the api requires an accept header")
+	ErrInvalidLanguage  = errors.New("invalid language tag")
+	ErrInvalidPrefix    = errors.New("the path prefix must start with a slash and not end with one")
+	ErrInvalidUnits     = errors.New(`the units must be "us" or "si"`)
+)
+
 const (
-	templateEndpointOffices = "%s/offices/%s"   // base url, office id
-	templateEndpointPoints  = "%s/points/%s,%s" // base url, lat, lon
+	templateEndpointAlerts            = "%s/alerts"                          // base url
+	templateEndpointAlertsActiveArea  = "%s/alerts/active/area/%s"           // base url, area code
+	templateEndpointAlertsActiveCount = "%s/alerts/active/count"             // base url
+	templateEndpointCWSU              = "%s/aviation/cwsus/%s"               // base url, cwsu id
+	templateEndpointCWAs              = "%s/aviation/cwsus/%s/cwas"          // base url, cwsu id
+	templateEndpointSIGMETs           = "%s/aviation/sigmets"                // base url
+	templateEndpointGridpointStations = "%s/gridpoints/%s/%d,%d/stations"    // base url, office id, grid x, grid y
+	templateEndpointObservations      = "%s/stations/%s/observations"        // base url, station id
+	templateEndpointObservationLatest = "%s/stations/%s/observations/latest" // base url, station id
+	templateEndpointObservationAt     = "%s/stations/%s/observations/%s"     // base url, station id, time
+	templateEndpointStation           = "%s/stations/%s"                     // base url, station id
+	templateEndpointStations          = "%s/stations"                        // base url
+	templateEndpointOffices           = "%s/offices/%s"                      // base url, office id
+	templateEndpointPoints            = "%s/points/%s,%s"                    // base url, lat, lon
+	templateEndpointProduct           = "%s/products/%s"                     // base url, product id
+	templateEndpointProducts          = "%s/products/types/%s/locations/%s"  // base url, product code, location id
+	templateEndpointZoneForecast      = "%s/zones/%s/%s/forecast"            // base url, zone type, zone id
 )
 
+// apiURL returns the URL that the endpoint paths are relative to. The endpoint
+// builders below path escape their arguments so that an ID containing a slash
+// or spaces can not change the path that is requested.
+func (c *Config) apiURL() string {
+	return c.BaseURL + c.PathPrefix
+}
+
+func (c *Config) endpointAlerts() string {
+	return fmt.Sprintf(templateEndpointAlerts, c.apiURL())
+}
+
+func (c *Config) endpointAlertsActiveArea(area string) string {
+	return fmt.Sprintf(templateEndpointAlertsActiveArea, c.apiURL(), url.PathEscape(area))
+}
+
+func (c *Config) endpointAlertsActiveCount() string {
+	return fmt.Sprintf(templateEndpointAlertsActiveCount, c.apiURL())
+}
+
+func (c *Config) endpointCWSU(cwsuID string) string {
+	return fmt.Sprintf(templateEndpointCWSU, c.apiURL(), url.PathEscape(cwsuID))
+}
+
+func (c *Config) endpointCWAs(cwsuID string) string {
+	return fmt.Sprintf(templateEndpointCWAs, c.apiURL(), url.PathEscape(cwsuID))
+}
+
+func (c *Config) endpointSIGMETs() string {
+	return fmt.Sprintf(templateEndpointSIGMETs, c.apiURL())
+}
+
+func (c *Config) endpointGridpointStations(wfo string, x int64, y int64) string {
+	return fmt.Sprintf(templateEndpointGridpointStations, c.apiURL(), url.PathEscape(wfo), x, y)
+}
+
+func (c *Config) endpointObservations(stationID string) string {
+	return fmt.Sprintf(templateEndpointObservations, c.apiURL(), url.PathEscape(stationID))
+}
+
+func (c *Config) endpointObservationLatest(stationID string) string {
+	return fmt.Sprintf(templateEndpointObservationLatest, c.apiURL(), url.PathEscape(stationID))
+}
+
+func (c *Config) endpointObservationAt(stationID string, t string) string {
+	return fmt.Sprintf(templateEndpointObservationAt, c.apiURL(), url.PathEscape(stationID), url.PathEscape(t))
+}
+
+func (c *Config) endpointStation(stationID string) string {
+	return fmt.Sprintf(templateEndpointStation, c.apiURL(), url.PathEscape(stationID))
+}
+
+func (c *Config) endpointStations() string {
+	return fmt.Sprintf(templateEndpointStations, c.apiURL())
+}
+
 func (c *Config) endpointOffices(id string) string {
-	return fmt.Sprintf(templateEndpointOffices, config.BaseURL, id)
+	return fmt.Sprintf(templateEndpointOffices, c.apiURL(), url.PathEscape(id))
 }
 
 func (c *Config) endpointPoints(lat string, lon string) string {
-	return fmt.Sprintf(templateEndpointPoints, config.BaseURL, lat, lon)
+	return fmt.Sprintf(templateEndpointPoints, c.apiURL(), url.PathEscape(lat), url.PathEscape(lon))
+}
+
+func (c *Config) endpointProduct(id string) string {
+	return fmt.Sprintf(templateEndpointProduct, c.apiURL(), url.PathEscape(id))
+}
+
+func (c *Config) endpointProducts(code string, location string) string {
+	return fmt.Sprintf(templateEndpointProducts, c.apiURL(), url.PathEscape(code), url.PathEscape(location))
 }
 
-func (c *Config) getUnitsQueryParam(prefix string) string {
+func (c *Config) endpointZoneForecast(zoneType string, zoneID string) string {
+	return fmt.Sprintf(templateEndpointZoneForecast, c.apiURL(), url.PathEscape(zoneType), url.PathEscape(zoneID))
+}
+
+func getUnitsQueryParam(prefix string, units string) string {
 	queryParam := ""
-	if config.Units != "" {
-		queryParam = prefix + "units=" + config.Units
+	if units != "" {
+		queryParam = prefix + "units=" + units
 	}
 	return queryParam
 }
 
+// withUnits returns a forecast endpoint of a point with the query of units, if
+// any, as requested by the forecast functions. See Endpoints.
+func withUnits(endpoint string, units string) string {
+	return endpoint + getUnitsQueryParam("?", units)
+}
+
 // SetUserAgent changes the string used for the User-Agent header when making
 // requests. See https://www.weather.gov/documentation/services-web-api
 // (Authentication) for details.  By default, this module uses a github.com URL.
-func SetUserAgent(userAgent string) {
+// An error is returned and the config is left unchanged if userAgent is blank.
+func SetUserAgent(userAgent string) error {
+	configMu.Lock()
+	defer configMu.Unlock()
 	if len(userAgent) == 0 {
-		panic("the api requires a user-agent")
+		return ErrMissingUserAgent
 	}
 	config.UserAgent = userAgent
+	warnDefaultUserAgent(config)
+	return nil
+}
+
+// SetLogger changes the logger used to report warnings such as using the
+// default User-Agent. A nil logger (the default) discards warnings.
+func SetLogger(logger *log.Logger) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.Logger = logger
+}
+
+// logf writes a warning to the logger of c, if any. Use a snapshot of the
+// config, or config while holding configMu.
+func (c *Config) logf(format string, v ...any) {
+	if c.Logger != nil {
+		c.Logger.Printf("noaa: "+format, v...)
+	}
+}
+
+// warnDefaultUserAgent logs a warning when the placeholder User-Agent is used.
+// weather.gov asks for a User-Agent that identifies the application and a way
+// to contact its owner.
+func warnDefaultUserAgent(c Config) {
+	if c.UserAgent == APIKey {
+		c.logf("using the default User-Agent %q, see SetUserAgent", APIKey)
+	}
 }
 
 // SetUnits can be used to change the units returned by the weather.gov API from
 // US to metric. By default, if no units are specified, then the API assumes US.
-func SetUnits(uom string) {
+// The units are "us" or "si", or the aliases "imperial" and "metric". Any other
+// value returns ErrInvalidUnits and leaves the units unchanged.
+func SetUnits(uom string) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	units, err := parseUnits(uom)
+	if err != nil {
+		return err
+	}
+	config.Units = units
+	return nil
+}
+
+// parseUnits returns the units named by uom, case insensitive: "us" or "si",
+// the aliases "imperial" and "metric", or "" for the API default.
+func parseUnits(uom string) (string, error) {
 	units := strings.ToLower(uom)
-	if units != "us" && units != "si" {
-		config.Units = ""
+	switch units {
+	case "", "us", "si":
+		return units, nil
+	case "imperial":
+		return "us", nil
+	case "metric":
+		return "si", nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidUnits, uom)
+}
+
+// Doer is the interface used to make HTTP requests to the API. *http.Client
+// satisfies Doer; other implementations can be used to mock the API in tests.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// SetClient changes the HTTP client used to make requests to the API. This can
+// be used to configure timeouts, proxies, transports, etc. or to inject a mock.
+// A client that has been set is used as is and never replaced by the client;
+// only a nil client resets the client back to http.DefaultClient. See
+// NewClientWithTransport for custom TLS or proxy settings.
+func SetClient(client Doer) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if c, ok := client.(*http.Client); ok && c == nil {
+		client = nil
+	}
+	config.Client = client
+}
+
+// NewClientWithTransport returns an *http.Client that uses the given transport
+// and timeout, e.g. an *http.Transport with a custom TLS config or proxy, to be
+// passed to SetClient. A nil transport uses http.DefaultTransport and a zero
+// timeout means no timeout.
+//
+//	transport := http.DefaultTransport.(*http.Transport).Clone()
+//	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+//	noaa.SetClient(noaa.NewClientWithTransport(transport, 10*time.Second))
+func NewClientWithTransport(rt http.RoundTripper, timeout time.Duration) *http.Client {
+	return &http.Client{Transport: rt, Timeout: timeout}
+}
+
+// SetTimeout changes the timeout of the HTTP client used to make requests. The
+// current client is copied with the new timeout so that a shared client (such
+// as http.DefaultClient) is never modified. Calling SetClient afterwards will
+// replace the client and its timeout. The timeout can only be set on an
+// *http.Client; for any other Doer a warning is logged and nothing changes.
+func SetTimeout(timeout time.Duration) {
+	updateHTTPClient("a timeout", func(client *http.Client) {
+		client.Timeout = timeout
+	})
+}
+
+// SetRoundTripper changes the transport of the HTTP client used to make
+// requests, e.g. to wrap it with caching, auth, or logging middleware, while
+// keeping the other settings of the client such as its timeout. Like
+// SetTimeout, the current client is copied so that a shared client is never
+// modified, and http.DefaultClient is copied if no client is set. SetTimeout
+// and SetRoundTripper can be combined in any order, but calling SetClient
+// afterwards replaces the client along with its transport. The transport can
+// only be set on an *http.Client; for any other Doer a warning is logged and
+// nothing changes.
+func SetRoundTripper(rt http.RoundTripper) {
+	updateHTTPClient("a transport", func(client *http.Client) {
+		client.Transport = rt
+	})
+}
+
+// updateHTTPClient replaces the configured client with a copy changed by
+// update, see SetTimeout. An empty client is used if none is set. A warning
+// naming what was to be set is logged if the client is not an *http.Client.
+func updateHTTPClient(what string, update func(client *http.Client)) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	client := http.Client{}
+	if config.Client != nil {
+		c, ok := config.Client.(*http.Client)
+		if !ok {
+			config.logf("can not set %s on a %T, see SetClient", what, config.Client)
+			return
+		}
+		client = *c
+	}
+	update(&client)
+	config.Client = &client
+}
+
+// SetDefaultTimeout sets a deadline for every call without a context argument,
+// such as Forecast, so that the total time of the call, including the point
+// lookup, retries, and following pages, is bounded by timeout. It applies on
+// top of the timeout of the HTTP client, see SetTimeout, which bounds each
+// request. The *Context variants, such as ForecastContext, ignore the default
+// and use the deadline of the provided context instead. Zero, the default,
+// disables the deadline.
+func SetDefaultTimeout(timeout time.Duration) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.DefaultTimeout = timeout
+}
+
+// SetRetries changes how many times failed requests are retried and the delay
+// before the first retry. The delay doubles after each retry. By default,
+// requests are not retried. Retries stop early if the request's context is
+// canceled or its deadline is exceeded.
+func SetRetries(retries int, delay time.Duration) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.Retries = retries
+	config.RetryDelay = delay
+}
+
+// SetRetryJitter enables or disables full jitter of the retry delay. When
+// enabled, each retry waits a random delay between zero and the backoff that
+// would otherwise be used. See SetJitterSource to make the delays repeatable.
+func SetRetryJitter(enabled bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.RetryJitter = enabled
+}
+
+// SetMaxPages changes how many pages of a paginated response, such as the
+// observations of a station, are requested and combined. The pagination
+// cursors are followed until there are no more pages or that many pages have
+// been requested, and the Pagination of the combined response is that of the
+// last page. By default only the first page is returned to bound the size of the
+// response, except by Alerts which follows every page. Use the NextPage method
+// of the response, e.g. ObservationsResponse.NextPage, to continue where the
+// last page left off.
+func SetMaxPages(pages int) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.MaxPages = pages
+}
+
+// SetNegativeCacheTTL enables caching of point lookups outside of the API's
+// coverage. Points returns the cached 404 error for coordinates that were not
+// found within the last ttl instead of requesting them again. Zero, the
+// default, disables the cache.
+func SetNegativeCacheTTL(ttl time.Duration) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.NegativeCacheTTL = ttl
+}
+
+// SetForecastCacheTTL enables caching of hourly forecasts. HourlyForecast
+// returns a cached forecast of the same point, units and feature flags for up
+// to ttl, but never after the forecast's ValidUntil, instead of requesting it
+// again. Forecasts without a valid ValidTimes are not cached. Zero, the
+// default, disables the cache.
+func SetForecastCacheTTL(ttl time.Duration) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.ForecastCacheTTL = ttl
+}
+
+// SetCircuitBreaker enables a circuit breaker that stops calling the API after
+// threshold consecutive requests failed with a network error, a 429, or a 5xx
+// response, even after retries. Requests then fail fast with ErrCircuitOpen
+// until cooldown has passed, after which a single request is let through to
+// probe the API. A threshold of zero, the default, disables the breaker.
+// Calling SetCircuitBreaker closes the breaker.
+func SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.CircuitThreshold = threshold
+	config.CircuitCooldown = cooldown
+	breaker.reset()
+}
+
+// SetAcceptFallback changes whether a request is retried once as
+// application/ld+json, the format supported by every endpoint, when the
+// response in the format set with SetAcceptFormat fails to decode or is
+// rejected with a 406. The fallback is enabled by default and is logged.
+func SetAcceptFallback(enabled bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.DisableAcceptFallback = !enabled
+}
+
+// SetFollowRedirects changes whether redirects returned by the API, e.g. when
+// an endpoint is relocated, are followed. Redirects are followed by default.
+// When disabled, a redirect is returned as an *APIError with its Location.
+func SetFollowRedirects(follow bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.DisableRedirects = !follow
+}
+
+// SetHeader adds a header that is sent with every request, for example an auth
+// token required by a proxy or API gateway. Extra headers take precedence over
+// the headers set by the client. An empty value removes the header.
+func SetHeader(key string, value string) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	headers := make(map[string]string, len(config.ExtraHeaders)+1)
+	for k, v := range config.ExtraHeaders {
+		headers[k] = v
+	}
+	if value == "" {
+		delete(headers, key)
 	} else {
-		config.Units = units
+		headers[key] = value
 	}
+	config.ExtraHeaders = headers
+}
+
+// SetOnResponse sets a function that is called after each request, e.g. to
+// record metrics or traces without wrapping the HTTP client. A nil function,
+// the default, disables the hook. The function may be called concurrently.
+func SetOnResponse(hook func(endpoint string, status int, bytes int, dur time.Duration)) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.OnResponse = hook
+}
+
+// SetDebug enables or disables recording the last raw response body and status
+// code of each endpoint, e.g. to attach a response that fails to decode to a bug
+// report. Recorded responses are available from LastRawResponse.
+func SetDebug(enabled bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.Debug = enabled
+}
+
+// SetStrictDecoding enables or disables failing to decode responses that have
+// fields that the response types do not, e.g. to detect new API fields while
+// testing. Unknown fields are ignored by default, which is recommended for
+// production use since the API adds fields over time. Fields inside values
+// with custom decoding, such as QuantitativeValue, are not checked.
+func SetStrictDecoding(strict bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.StrictDecoding = strict
+}
+
+// SetPrecipThreshold changes the probability of precipitation, as a percent,
+// at or above which HourlyForecastResponse's NextChange reports that
+// precipitation is expected. DefaultPrecipThreshold is used if zero.
+func SetPrecipThreshold(percent float64) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.PrecipThreshold = percent
+}
+
+// SetStrictCoordinates changes whether a blank or zero lat, lon is rejected
+// with ErrInvalidCoordinates before any request is made. It is disabled by
+// default, in which case the API returns a 404 for them, see IsOutsideUS.
+func SetStrictCoordinates(strict bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.StrictCoordinates = strict
+}
+
+// SetQuantitativeValues enables or disables the forecast feature flags that
+// request quantitative values (QV) from the API. QV are enabled by default but
+// cause the API to ignore the requested units; the client converts them to the
+// configured units instead. When disabled, the API returns the classic values
+// in the requested units and Temperature/WindSpeed are decoded from those.
+func SetQuantitativeValues(enabled bool) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config.DisableQuantitativeValues = !enabled
+}
+
+// defaultFeatureFlags enable quantitative values in forecast responses.
+var defaultFeatureFlags = []string{"forecast_temperature_qv", "forecast_wind_speed_qv"}
+
+// Option changes a single call, such as Forecast, without changing the config.
+type Option func(*callOptions)
+
+type callOptions struct {
+	featureFlags     []string
+	hasFlags         bool
+	stopOnFirstError bool
+}
+
+type featureFlagsKey struct{}
+
+// WithFeatureFlags overrides the feature-flags header of a single request, e.g.
+// to try quantitative values for some locations only. The global default is
+// set with SetQuantitativeValues. No flags sends no feature-flags header.
+//
+//	noaa.Forecast(lat, lon, noaa.WithFeatureFlags("forecast_temperature_qv"))
+func WithFeatureFlags(flags ...string) Option {
+	return func(o *callOptions) {
+		o.featureFlags = flags
+		o.hasFlags = true
+	}
+}
+
+// WithStopOnFirstError makes a batch call, such as ForecastBatch, stop at the
+// first location that fails instead of fetching every location. Other calls
+// ignore it.
+func WithStopOnFirstError(stop bool) Option {
+	return func(o *callOptions) {
+		o.stopOnFirstError = stop
+	}
+}
+
+// withOptions returns ctx carrying the options of a call for getOnce.
+func withOptions(ctx context.Context, opts []Option) context.Context {
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.hasFlags {
+		ctx = context.WithValue(ctx, featureFlagsKey{}, o.featureFlags)
+	}
+	return ctx
+}
+
+// featureFlags returns the feature flags to send with a request made with ctx.
+func featureFlags(ctx context.Context) []string {
+	if flags, ok := ctx.Value(featureFlagsKey{}).([]string); ok {
+		return flags
+	}
+	if configFrom(ctx).DisableQuantitativeValues {
+		return nil
+	}
+	return defaultFeatureFlags
 }
 
 // SetConfig replaces the config with all new values in one call. The individual
-// Set* functions can also be used to replace only specified values.
-func SetConfig(c Config) {
+// Set* functions can also be used to replace only specified values. An error is
+// returned and the config is left unchanged if c is not valid. The cached
+// points, station lists and hourly forecasts are cleared if BaseURL or
+// PathPrefix change.
+func SetConfig(c Config) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	return setConfig(c)
+}
+
+func setConfig(c Config) error {
 	if !isConfigValid(c) {
-		panic("invalid configuration")
+		return ErrInvalidConfig
+	}
+	if c.BaseURL != config.BaseURL || c.PathPrefix != config.PathPrefix {
+		clearCaches()
 	}
 	config = c
+	warnDefaultUserAgent(config)
+	return nil
+}
+
+// UpdateConfig merges the non-zero fields of partial onto the current config and
+// leaves the other fields unchanged, e.g. UpdateConfig(Config{Units: "si"}).
+// Because zero values are ignored, boolean fields can only be set to true and
+// fields can not be cleared this way; use the individual Set* functions or
+// SetConfig for that. An error is returned and the config is left unchanged if
+// the merged config is not valid.
+func UpdateConfig(partial Config) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	merged := config
+	src := reflect.ValueOf(partial)
+	dst := reflect.ValueOf(&merged).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if !src.Field(i).IsZero() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return setConfig(merged)
 }
 
 // GetConfig is used to return the current configuration of the client. This allows
 // for testing and inspection as needed.
 func GetConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
 	return config
 }
 
@@ -96,28 +756,182 @@ func GetDefaultConfig() Config {
 		UserAgent: APIKey,
 		Accept:    APIAccept,
 		Units:     "", // defaults to US units if unspecified
+
+		AcceptLanguage: "en-US",
+
+		MaxResponseBytes: DefaultMaxResponseBytes,
+	}
+}
+
+// ConfigFromEnv returns the default config with the values set in the
+// environment, to be passed to SetConfig. The following variables are read:
+//
+//	NOAA_BASE_URL         Config.BaseURL
+//	NOAA_PATH_PREFIX      Config.PathPrefix
+//	NOAA_USER_AGENT       Config.UserAgent
+//	NOAA_ACCEPT           Config.Accept
+//	NOAA_ACCEPT_LANGUAGE  Config.AcceptLanguage
+//	NOAA_UNITS            Config.Units, "us" or "si" (or "imperial", "metric")
+//	NOAA_RETRIES          Config.Retries, e.g. 3
+//	NOAA_RETRY_DELAY      Config.RetryDelay, e.g. 500ms
+//	NOAA_TIMEOUT          the timeout of an *http.Client, e.g. 10s
+//	NOAA_MAX_PAGES        Config.MaxPages, e.g. 5
+//	NOAA_DEBUG            Config.Debug, e.g. true
+//
+// Unset variables keep their default values. An error is returned if a value
+// can not be parsed or the resulting config is not valid.
+func ConfigFromEnv() (Config, error) {
+	c := GetDefaultConfig()
+	strs := map[string]*string{
+		"NOAA_BASE_URL":        &c.BaseURL,
+		"NOAA_PATH_PREFIX":     &c.PathPrefix,
+		"NOAA_USER_AGENT":      &c.UserAgent,
+		"NOAA_ACCEPT":          &c.Accept,
+		"NOAA_ACCEPT_LANGUAGE": &c.AcceptLanguage,
+	}
+	for name, field := range strs {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	var err error
+	env := func(name string, parse func(string) error) {
+		if value, ok := os.LookupEnv(name); ok && err == nil {
+			if parseErr := parse(value); parseErr != nil {
+				err = fmt.Errorf("%w: %s=%q: %v", ErrInvalidConfig, name, value, parseErr)
+			}
+		}
+	}
+	env("NOAA_UNITS", func(v string) (err error) {
+		c.Units, err = parseUnits(v)
+		return err
+	})
+	env("NOAA_RETRIES", func(v string) (err error) {
+		c.Retries, err = strconv.Atoi(v)
+		return err
+	})
+	env("NOAA_RETRY_DELAY", func(v string) (err error) {
+		c.RetryDelay, err = time.ParseDuration(v)
+		return err
+	})
+	env("NOAA_TIMEOUT", func(v string) error {
+		timeout, err := time.ParseDuration(v)
+		c.Client = &http.Client{Timeout: timeout}
+		return err
+	})
+	env("NOAA_MAX_PAGES", func(v string) (err error) {
+		c.MaxPages, err = strconv.Atoi(v)
+		return err
+	})
+	env("NOAA_DEBUG", func(v string) (err error) {
+		c.Debug, err = strconv.ParseBool(v)
+		return err
+	})
+	if err != nil {
+		return Config{}, err
+	}
+	if !isConfigValid(c) {
+		return Config{}, ErrInvalidConfig
 	}
+	return c, nil
 }
 
 // SetBaseURL changes the base URL of the API. This can be useful for testing
 // and if the weather.gov endpoint is relocated, in a pinch you could set it.
-// Probably not useful in general.
-func SetBaseURL(url string) {
+// Probably not useful in general. The cached points, station lists and hourly
+// forecasts are cleared when the base URL changes.
+func SetBaseURL(url string) error {
+	configMu.Lock()
+	defer configMu.Unlock()
 	if len(url) == 0 {
-		panic("the api requires a base url")
+		return ErrMissingBaseURL
+	}
+	if url != config.BaseURL {
+		clearCaches()
 	}
 	config.BaseURL = url
+	return nil
+}
+
+// SetPathPrefix changes the prefix added to the path of every endpoint, for
+// example "/v2" if weather.gov introduces a versioned API, while keeping the
+// BaseURL. An empty prefix, the default, uses the current unversioned API.
+// The cached points, station lists and hourly forecasts are cleared when the
+// prefix changes.
+func SetPathPrefix(prefix string) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if !isPathPrefixValid(prefix) {
+		return ErrInvalidPrefix
+	}
+	if prefix != config.PathPrefix {
+		clearCaches()
+	}
+	config.PathPrefix = prefix
+	return nil
 }
 
-// SetAcceptHeader changes the format of the response. Note, this is largely a
-// placeholder for future use and testing as the Go types defined in this wrapper
-// assume application/ld+json. Using anything else is undefined.
+func isPathPrefixValid(prefix string) bool {
+	return prefix == "" || (strings.HasPrefix(prefix, "/") && !strings.HasSuffix(prefix, "/"))
+}
+
+// Format is a response format that can be requested from the API with the
+// Accept header. See SetAcceptFormat.
+type Format string
+
+// Response formats supported by the API.
+const (
+	AcceptLDJSON  Format = "application/ld+json" // the default, see APIAccept
+	AcceptGeoJSON Format = "application/geo+json"
+	AcceptCAP     Format = "application/cap+xml" // Common Alerting Protocol, alerts only
+)
+
+// SetAcceptFormat changes the format of the response to one of the supported
+// formats. Responses in JSON-LD and GeoJSON are decoded into the types of this
+// package. CAP (XML) is only served for alerts and is not decoded; use Raw to
+// get the XML. An error is returned for unsupported formats.
+func SetAcceptFormat(f Format) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	switch f {
+	case AcceptLDJSON, AcceptGeoJSON, AcceptCAP:
+		config.Accept = string(f)
+		return nil
+	}
+	return fmt.Errorf("unsupported accept format %q", f)
+}
+
+// SetAcceptHeader changes the format of the response. The Go types defined in
+// this wrapper are mapped to application/ld+json. application/geo+json is also
+// supported by unwrapping the GeoJSON "properties" before decoding. Using
+// anything else is undefined.
 // Probably not useful in general.
-func SetAcceptHeader(accept string) {
+func SetAcceptHeader(accept string) error {
+	configMu.Lock()
+	defer configMu.Unlock()
 	if len(accept) == 0 {
-		panic("the api requires an accept header")
+		return ErrMissingAccept
 	}
 	config.Accept = accept
+	return nil
+}
+
+// languageTag matches language tags such as "en", "en-US", or "es-419".
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// SetAcceptLanguage changes the language requested with the Accept-Language
+// header, "en-US" by default. The API ignores the header for most endpoints but
+// some products are available in other languages. An error is returned if
+// language is not a language tag such as "es-US".
+func SetAcceptLanguage(language string) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if !languageTag.MatchString(language) {
+		return fmt.Errorf("%w: %q", ErrInvalidLanguage, language)
+	}
+	config.AcceptLanguage = language
+	return nil
 }
 
 // isConfigValid determines whether the provided config might be valid. Under
@@ -129,5 +943,11 @@ func isConfigValid(c Config) bool {
 	if len(c.Accept) == 0 || len(c.BaseURL) == 0 || len(c.UserAgent) == 0 {
 		return false
 	}
+	if !isPathPrefixValid(c.PathPrefix) {
+		return false
+	}
+	if len(c.AcceptLanguage) > 0 && !languageTag.MatchString(c.AcceptLanguage) {
+		return false
+	}
 	return true
 }
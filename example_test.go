@@ -9,6 +9,8 @@ package noaa_test
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/icodealot/noaa"
 )
@@ -59,7 +61,8 @@ func ExampleSetUnits() {
 	beforeEachExample()
 
 	// Set the units.
-	// Units can be set to "us" or "si" and otherwise, blank "" defaults to US units.
+	// Units can be set to "us" or "si" (or "imperial" and "metric") and blank ""
+	// defaults to US units. Other values return an error.
 	noaa.SetUnits("si")
 
 	// Get the current configuration:
@@ -71,6 +74,24 @@ func ExampleSetUnits() {
 	// Units should now be: si
 }
 
+func ExampleSetTimeout() {
+
+	// Cleanup global state before each example
+	beforeEachExample()
+
+	// Fail requests that take longer than 10 seconds rather than waiting on
+	// the weather.gov API indefinitely.
+	noaa.SetTimeout(10 * time.Second)
+
+	// Get the current configuration:
+	config := noaa.GetConfig()
+
+	fmt.Println("Timeout should now be:", config.Client.(*http.Client).Timeout)
+
+	// Output:
+	// Timeout should now be: 10s
+}
+
 func ExampleGetChicagoForecast() {
 
 	// Cleanup global state before each example
@@ -0,0 +1,10 @@
+//go:build !examples
+// +build !examples
+
+package noaa
+
+// Unexported state that the tests in package noaa_test reset between tests.
+var (
+	ResetGenerators = resetGenerators
+	ResetZipCodes   = resetZipCodes
+)
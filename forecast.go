@@ -0,0 +1,548 @@
+package noaa
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeriodsOn returns the forecast periods that start on the calendar day of date
+// in the timezone of the forecast point, typically a day and night pair. If the
+// point's timezone cannot be loaded then the location of date is used instead.
+// An empty slice is returned if date is outside the forecast window.
+func (f *ForecastResponse) PeriodsOn(date time.Time) []ForecastResponsePeriod {
+	loc := date.Location()
+	if f.Point != nil {
+		if pointLoc, err := f.Point.Location(); err == nil {
+			loc = pointLoc
+		}
+	}
+	year, month, day := date.In(loc).Date()
+
+	periods := []ForecastResponsePeriod{}
+	for _, period := range f.Periods {
+		start, err := time.Parse(time.RFC3339, period.StartTime)
+		if err != nil {
+			continue
+		}
+		y, m, d := start.In(loc).Date()
+		if y == year && m == month && d == day {
+			periods = append(periods, period)
+		}
+	}
+	return periods
+}
+
+// Digest returns a one line summary of the next n periods of the forecast, for
+// example "Today: Sunny, high 75°F. Tonight: Clear, low 58°F." Temperatures
+// are in the units the forecast was requested in. All periods are included if
+// n is larger than the number of periods.
+func (f *ForecastResponse) Digest(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n > len(f.Periods) {
+		n = len(f.Periods)
+	}
+	parts := []string{}
+	for _, period := range f.Periods[:n] {
+		level := "low"
+		if period.IsDaytime {
+			level = "high"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s, %s %.0f°%s.",
+			period.Name, period.Summary, level, math.Round(period.Temperature), period.TemperatureUnit))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Hourly returns the hourly forecast for the same point as the forecast. The
+// point is reused so no additional point lookup is made.
+func (f *ForecastResponse) Hourly() (*HourlyForecastResponse, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return hourlyForecast(ctx, f.Point, configFrom(ctx).Units)
+}
+
+// ApparentTemperature returns the temperature the period feels like and its
+// unit, "C" if the TemperatureUnit of the period is "C", that is the forecast
+// was requested in "si" units, and "F" otherwise. The heat index is used
+// when it is 80°F or warmer and the relative humidity is known, the wind chill
+// when it is 50°F or colder with wind over 3 mph, and the temperature otherwise.
+// The upper bound of a wind speed range is used. An error is returned if the
+// period has no temperature.
+func (p ForecastResponsePeriod) ApparentTemperature() (float64, string, error) {
+	t, err := p.fahrenheit()
+	if err != nil {
+		return 0, "", err
+	}
+
+	wind := convert(p.QuantitativeWindSpeed, unitMph)
+	mph := math.Max(wind.Value, wind.MaxValue)
+	rh := p.QuantitativeRelativeHumidity
+
+	feelsLike := t
+	switch {
+	case t >= 80 && rh.HasValue():
+		feelsLike = heatIndex(t, rh.Value)
+	case t <= 50 && wind.UnitCode == unitMph && mph > 3:
+		feelsLike = windChill(t, mph)
+	}
+
+	if p.TemperatureUnit == "C" {
+		return conversions[[2]string{unitDegF, unitDegC}](feelsLike), "C", nil
+	}
+	return feelsLike, "F", nil
+}
+
+// ParseIcon extracts the condition code, e.g. "sct" or "tsra", whether it is
+// day or night, and the optional percentage (0 if absent) from the Icon URL of
+// the period, e.g. https://api.weather.gov/icons/land/day/rain_showers,40?size=medium.
+// Icons that show two conditions, such as .../rain_showers,40/tsra,70, return
+// the first (primary) condition.
+func (p ForecastResponsePeriod) ParseIcon() (condition string, isDay bool, coverage int, err error) {
+	u, err := url.Parse(p.Icon)
+	if err != nil {
+		return "", false, 0, err
+	}
+	// the path is /icons/<land|marine>/<day|night>/<condition>[,<percent>][/...]
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		if segment != "icons" || len(segments) < i+4 {
+			continue
+		}
+		switch segments[i+2] {
+		case "day":
+			isDay = true
+		case "night":
+		default:
+			return "", false, 0, fmt.Errorf("invalid icon time of day %q", segments[i+2])
+		}
+		condition = segments[i+3]
+		if c, percent, ok := strings.Cut(condition, ","); ok {
+			condition = c
+			if coverage, err = strconv.Atoi(percent); err != nil {
+				return "", false, 0, fmt.Errorf("invalid icon percentage %q: %w", percent, err)
+			}
+		}
+		return condition, isDay, coverage, nil
+	}
+	return "", false, 0, fmt.Errorf("invalid icon url %q", p.Icon)
+}
+
+// fahrenheit returns the temperature of the period in °F from the QV
+// temperature, or the legacy temperature if the period has no QV.
+func (p ForecastResponsePeriod) fahrenheit() (float64, error) {
+	if p.QuantitativeTemperature.HasValue() {
+		q := convert(p.QuantitativeTemperature, unitDegF)
+		if q.UnitCode != unitDegF {
+			return 0, fmt.Errorf("unknown temperature unit %q", q.UnitCode)
+		}
+		return q.Value, nil
+	}
+	switch p.TemperatureUnit {
+	case "F":
+		return p.Temperature, nil
+	case "C":
+		return conversions[[2]string{unitDegC, unitDegF}](p.Temperature), nil
+	}
+	return 0, errors.New("forecast period has no temperature")
+}
+
+// heatIndex returns the NWS heat index in °F using the Rothfusz regression.
+// See https://www.wpc.ncep.noaa.gov/html/heatindex_equation.shtml
+func heatIndex(t, rh float64) float64 {
+	hi := -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+		0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh +
+		0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+	switch {
+	case rh < 13 && t <= 112:
+		hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+	case rh > 85 && t <= 87:
+		hi += (rh - 85) / 10 * (87 - t) / 5
+	}
+	return hi
+}
+
+// windChill returns the NWS wind chill in °F for a wind speed in mph.
+// See https://www.weather.gov/media/epz/wxcalc/windChill.pdf
+func windChill(t, mph float64) float64 {
+	v := math.Pow(mph, 0.16)
+	return 35.74 + 0.6215*t - 35.75*v + 0.4275*t*v
+}
+
+// IsStale reports whether the forecast was last updated more than maxAge ago,
+// e.g. because the office has not issued a new forecast. An error is returned
+// if Updated can not be parsed.
+func (f *ForecastResponse) IsStale(maxAge time.Duration) (bool, error) {
+	return isStale(f.Updated, maxAge)
+}
+
+// IsStale reports whether the hourly forecast was last updated more than maxAge
+// ago. UpdateTime is used, or Updated if the response does not include it.
+func (h *HourlyForecastResponse) IsStale(maxAge time.Duration) (bool, error) {
+	updated := h.UpdateTime
+	if updated == "" {
+		updated = h.Updated
+	}
+	return isStale(updated, maxAge)
+}
+
+// isStale reports whether the RFC 3339 time updated is more than maxAge ago.
+func isStale(updated string, maxAge time.Duration) (bool, error) {
+	t, err := time.Parse(time.RFC3339, updated)
+	if err != nil {
+		return false, fmt.Errorf("invalid update time %q: %w", updated, err)
+	}
+	return time.Since(t) > maxAge, nil
+}
+
+// ValidUntil returns the end of the interval for which the hourly forecast is
+// valid, parsed from ValidTimes, e.g. 2023-05-21T14:00:00+00:00/P7DT11H. This
+// is a better hint for how long to cache a forecast than a fixed duration.
+func (h *HourlyForecastResponse) ValidUntil() (time.Time, error) {
+	_, end, err := parseInterval(h.ValidTimes)
+	return end, err
+}
+
+// DaylightHours approximates sunrise and sunset on the calendar day of date in
+// the timezone of the forecast point from the hours at which IsDaytime changes
+// in the hourly periods. The times are only accurate to the hour. False is
+// returned unless both changes occur on that day within the forecast, e.g. on
+// the first day of the forecast if it starts after sunrise.
+func (h *HourlyForecastResponse) DaylightHours(date time.Time) (sunriseApprox, sunsetApprox time.Time, ok bool) {
+	loc := date.Location()
+	if h.Point != nil {
+		if pointLoc, err := h.Point.Location(); err == nil {
+			loc = pointLoc
+		}
+	}
+	year, month, day := date.In(loc).Date()
+
+	for i := 1; i < len(h.Periods); i++ {
+		prev, cur := h.Periods[i-1], h.Periods[i]
+		if prev.IsDaytime == cur.IsDaytime {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, cur.StartTime)
+		if err != nil {
+			continue
+		}
+		start = start.In(loc)
+		if y, m, d := start.Date(); y != year || m != month || d != day {
+			continue
+		}
+		if cur.IsDaytime && sunriseApprox.IsZero() {
+			sunriseApprox = start
+		} else if !cur.IsDaytime && sunsetApprox.IsZero() {
+			sunsetApprox = start
+		}
+	}
+	if sunriseApprox.IsZero() || sunsetApprox.IsZero() {
+		return time.Time{}, time.Time{}, false
+	}
+	return sunriseApprox, sunsetApprox, true
+}
+
+// MaxPrecipProbability returns the highest probability of precipitation (as a
+// percent) of the hourly periods that overlap the window starting now, and the
+// start time of the period it occurs in. Periods without a probability are
+// skipped. A zero time is returned if no period in the window has a
+// probability. See MaxPrecipProbabilityFrom.
+func (h *HourlyForecastResponse) MaxPrecipProbability(window time.Duration) (percent float64, at time.Time) {
+	return h.MaxPrecipProbabilityFrom(time.Now(), window)
+}
+
+// MaxPrecipProbabilityFrom is like MaxPrecipProbability but for the window
+// starting at from instead of now.
+func (h *HourlyForecastResponse) MaxPrecipProbabilityFrom(from time.Time, window time.Duration) (percent float64, at time.Time) {
+	until := from.Add(window)
+	for _, period := range h.Periods {
+		if !period.QuantitativeProbability.HasValue() {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, period.StartTime)
+		if err != nil || !start.Before(until) {
+			continue
+		}
+		end, err := time.Parse(time.RFC3339, period.EndTime)
+		if err != nil || !end.After(from) {
+			continue
+		}
+		if at.IsZero() || period.QuantitativeProbability.Value > percent {
+			percent, at = period.QuantitativeProbability.Value, start
+		}
+	}
+	return percent, at
+}
+
+// NextChange returns the start time of the first hourly period in which the
+// named field changes meaningfully from the previous period, along with the
+// values before and after the change. The supported fields, by JSON name, are:
+//
+//   - "shortForecast": any change of the summary, e.g. "Sunny" to "Cloudy"
+//   - "probabilityOfPrecipitation": crossing the precipitation threshold in
+//     effect when NextChange is called, see SetPrecipThreshold, e.g. "35%" to
+//     "60%"
+//   - "temperature": crossing freezing in either direction, e.g. "34°F" to "32°F"
+//
+// False is returned if the field does not change or is not supported.
+func (h *HourlyForecastResponse) NextChange(field string) (at time.Time, from string, to string, ok bool) {
+	threshold := snapshotConfig().PrecipThreshold
+	if threshold == 0 {
+		threshold = DefaultPrecipThreshold
+	}
+
+	// state returns the state of a period that must change and its value
+	var state func(period ForecastResponsePeriodHourly) (string, string)
+	switch field {
+	case "shortForecast":
+		state = func(period ForecastResponsePeriodHourly) (string, string) {
+			return period.Summary, period.Summary
+		}
+	case "probabilityOfPrecipitation":
+		state = func(period ForecastResponsePeriodHourly) (string, string) {
+			probability := period.QuantitativeProbability
+			return strconv.FormatBool(probability.Value >= threshold), probability.String()
+		}
+	case "temperature":
+		state = func(period ForecastResponsePeriodHourly) (string, string) {
+			freezing := 32.0
+			if period.TemperatureUnit == "C" {
+				freezing = 0
+			}
+			value := strconv.FormatFloat(period.Temperature, 'f', -1, 64) + "°" + period.TemperatureUnit
+			return strconv.FormatBool(period.Temperature <= freezing), value
+		}
+	default:
+		return at, from, to, false
+	}
+
+	for i := 1; i < len(h.Periods); i++ {
+		previous, from := state(h.Periods[i-1])
+		current, to := state(h.Periods[i])
+		if current == previous {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, h.Periods[i].StartTime)
+		if err != nil {
+			return time.Time{}, "", "", false
+		}
+		return at, from, to, true
+	}
+	return at, from, to, false
+}
+
+// Bucket merges consecutive hourly periods into periods of the given size, such
+// as 6 hours for a morning, afternoon, evening and overnight view. When size
+// divides a day evenly the buckets are aligned to local midnight of the first
+// period, otherwise they begin at the first period. The fields of each bucket
+// are aggregated from its hours as follows:
+//
+//   - ID: the 1-based number of the bucket
+//   - StartTime, EndTime: the start of its first hour and the end of its last
+//   - IsDaytime: true if most of its hours are daytime
+//   - Temperature, QuantitativeTemperature, QuantitativeDewpoint and
+//     QuantitativeRelativeHumidity: the mean of the hours with a value, with
+//     Temperature rounded to a whole degree
+//   - QuantitativeProbability: the maximum probability of precipitation
+//   - Summary and Icon: the most frequent summary, ties going to the earliest,
+//     and the icon of its first hour
+//   - WindSpeed, WindDirection and QuantitativeWindSpeed: from the windiest hour
+//   - WindGust and QuantitativeWindGust: from the gustiest hour
+//   - TemperatureUnit: from the first hour
+//
+// Name, TemperatureTrend and Details are left empty. Nil is returned if size
+// is not positive or there are no periods with a valid start time.
+func (h *HourlyForecastResponse) Bucket(size time.Duration) []ForecastResponsePeriod {
+	if size <= 0 {
+		return nil
+	}
+	var buckets []ForecastResponsePeriod
+	var hours []ForecastResponsePeriodHourly
+	var end time.Time
+	for _, period := range h.Periods {
+		start, err := time.Parse(time.RFC3339, period.StartTime)
+		if err != nil {
+			continue
+		}
+		if end.IsZero() {
+			end = start
+			if (24*time.Hour)%size == 0 {
+				midnight := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+				end = midnight.Add(start.Sub(midnight) / size * size)
+			}
+			end = end.Add(size)
+		}
+		if !start.Before(end) {
+			buckets = append(buckets, mergeHours(len(buckets)+1, hours))
+			hours = nil
+			for !start.Before(end) {
+				end = end.Add(size)
+			}
+		}
+		hours = append(hours, period)
+	}
+	if len(hours) > 0 {
+		buckets = append(buckets, mergeHours(len(buckets)+1, hours))
+	}
+	return buckets
+}
+
+// mergeHours aggregates hourly periods into a single period, see Bucket.
+func mergeHours(id int, hours []ForecastResponsePeriodHourly) ForecastResponsePeriod {
+	first, last := hours[0], hours[len(hours)-1]
+	merged := ForecastResponsePeriod{
+		ID:              int32(id),
+		StartTime:       first.StartTime,
+		EndTime:         last.EndTime,
+		TemperatureUnit: first.TemperatureUnit,
+	}
+
+	var daytime, temperatures, legacyTemperatures int
+	var temperature, dewpoint, humidity, probability QuantitativeValue
+	var temperatureSum, legacyTemperatureSum, dewpointSum, humiditySum float64
+	var dewpoints, humidities int
+	counts := make(map[string]int)
+	windiest, gustiest := first, first
+	for _, hour := range hours {
+		if hour.IsDaytime {
+			daytime++
+		}
+		// the legacy value is only missing when the QV data has no value
+		if hour.QuantitativeTemperature.UnitCode == "" || hour.QuantitativeTemperature.HasValue() {
+			legacyTemperatureSum += hour.Temperature
+			legacyTemperatures++
+		}
+		if hour.QuantitativeTemperature.HasValue() {
+			temperature = hour.QuantitativeTemperature
+			temperatureSum += hour.QuantitativeTemperature.Value
+			temperatures++
+		}
+		if hour.QuantitativeDewpoint.HasValue() {
+			dewpoint = hour.QuantitativeDewpoint
+			dewpointSum += hour.QuantitativeDewpoint.Value
+			dewpoints++
+		}
+		if hour.QuantitativeRelativeHumidity.HasValue() {
+			humidity = hour.QuantitativeRelativeHumidity
+			humiditySum += hour.QuantitativeRelativeHumidity.Value
+			humidities++
+		}
+		if hour.QuantitativeProbability.HasValue() &&
+			(!probability.HasValue() || hour.QuantitativeProbability.Value > probability.Value) {
+			probability = hour.QuantitativeProbability
+		}
+		counts[hour.Summary]++
+		if windSpeed(hour) > windSpeed(windiest) {
+			windiest = hour
+		}
+		if hour.QuantitativeWindGust.Value > gustiest.QuantitativeWindGust.Value {
+			gustiest = hour
+		}
+	}
+
+	merged.IsDaytime = daytime*2 > len(hours)
+	if legacyTemperatures > 0 {
+		merged.Temperature = math.Round(legacyTemperatureSum / float64(legacyTemperatures))
+	}
+	merged.QuantitativeTemperature = mean(temperature, temperatureSum, temperatures)
+	merged.QuantitativeDewpoint = mean(dewpoint, dewpointSum, dewpoints)
+	merged.QuantitativeRelativeHumidity = mean(humidity, humiditySum, humidities)
+	merged.QuantitativeProbability = probability
+	for _, hour := range hours {
+		if counts[hour.Summary] > counts[merged.Summary] {
+			merged.Summary, merged.Icon = hour.Summary, hour.Icon
+		}
+	}
+	merged.WindSpeed, merged.WindDirection = windiest.WindSpeed, windiest.WindDirection
+	merged.QuantitativeWindSpeed = windiest.QuantitativeWindSpeed
+	merged.WindGust, merged.QuantitativeWindGust = gustiest.WindGust, gustiest.QuantitativeWindGust
+	return merged
+}
+
+// mean returns a value with the unit of sample and the mean of n values
+// totaling sum, or an empty value if n is 0.
+func mean(sample QuantitativeValue, sum float64, n int) QuantitativeValue {
+	if n == 0 {
+		return QuantitativeValue{}
+	}
+	return NewQuantitativeValue(sum/float64(n), sample.UnitCode)
+}
+
+// windSpeed returns the (upper) wind speed of a period from the quantitative
+// value if present, otherwise from the last number of the legacy string, e.g.
+// 15 for "10 to 15 mph". Zero is returned if neither can be read.
+func windSpeed(p ForecastResponsePeriod) float64 {
+	if p.QuantitativeWindSpeed.HasValue() {
+		return math.Max(p.QuantitativeWindSpeed.Value, p.QuantitativeWindSpeed.MaxValue)
+	}
+	fields := strings.Fields(p.WindSpeed)
+	if len(fields) >= 3 && fields[1] == "to" {
+		fields = fields[2:]
+	}
+	if len(fields) == 0 {
+		return 0
+	}
+	speed, _ := strconv.ParseFloat(fields[0], 64)
+	return speed
+}
+
+// Generator returns the name of the algorithm NWS used to generate the hourly
+// forecast, for example "HourlyForecastGenerator".
+func (h *HourlyForecastResponse) Generator() string {
+	return h.ForecastGenerator
+}
+
+// CheckGenerator returns an error if the hourly forecast was not generated by
+// the expected generator. This lets callers detect when NWS changes the
+// algorithm used to generate forecasts.
+func (h *HourlyForecastResponse) CheckGenerator(expected string) error {
+	if h.ForecastGenerator != expected {
+		return fmt.Errorf("forecast generator is %q, expected %q", h.ForecastGenerator, expected)
+	}
+	return nil
+}
+
+// generators holds the forecast generator of the first and latest hourly
+// forecasts, see ForecastGeneratorChanged.
+var generators struct {
+	sync.Mutex
+	first  string
+	latest string
+}
+
+// recordGenerator remembers the generator of an hourly forecast response.
+func recordGenerator(name string) {
+	if name == "" {
+		return
+	}
+	generators.Lock()
+	defer generators.Unlock()
+	if generators.first == "" {
+		generators.first = name
+	}
+	generators.latest = name
+}
+
+// resetGenerators forgets the recorded generators, e.g. between tests.
+func resetGenerators() {
+	generators.Lock()
+	defer generators.Unlock()
+	generators.first, generators.latest = "", ""
+}
+
+// ForecastGeneratorChanged reports whether the generator of the latest hourly
+// forecast differs from that of the first hourly forecast fetched by this
+// process, along with both generator names. Long running services can use it
+// to log when NWS switches the algorithm used to generate forecasts.
+func ForecastGeneratorChanged() (changed bool, first string, latest string) {
+	generators.Lock()
+	defer generators.Unlock()
+	return generators.latest != generators.first, generators.first, generators.latest
+}
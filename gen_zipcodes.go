@@ -0,0 +1,129 @@
+//go:build ignore
+// +build ignore
+
+// gen_zipcodes converts the Census Bureau's national ZCTA gazetteer file, a
+// tab separated file such as 2020_Gaz_zcta_national.txt, into the zipcodes.csv
+// table bundled with the package. The internal point of each ZIP Code
+// Tabulation Area is used as its centroid. The gazetteer file is read from a
+// path or downloaded from a URL, and unpacked if it is a zip archive as
+// published by the Census Bureau. Run it with go generate.
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func main() {
+	output := flag.String("o", "zipcodes.csv", "the CSV file to write")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: go run gen_zipcodes.go [-o zipcodes.csv] <ZCTA gazetteer file>")
+	}
+	if err := convert(flag.Arg(0), *output); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func convert(input string, output string) error {
+	in, err := open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	scanner := bufio.NewScanner(in)
+	if !scanner.Scan() {
+		return fmt.Errorf("%s: missing header", input)
+	}
+	columns := map[string]int{}
+	for i, name := range strings.Split(scanner.Text(), "\t") {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"GEOID", "INTPTLAT", "INTPTLONG"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("%s: missing column %s", input, name)
+		}
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer := csv.NewWriter(out)
+	if err := writer.Write([]string{"zip", "lat", "lon"}); err != nil {
+		return err
+	}
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < len(columns) {
+			continue
+		}
+		err := writer.Write([]string{
+			strings.TrimSpace(fields[columns["GEOID"]]),
+			strings.TrimSpace(fields[columns["INTPTLAT"]]),
+			strings.TrimSpace(fields[columns["INTPTLONG"]]),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// open returns the gazetteer file at input, a path or an http(s) URL. The first
+// .txt file is returned if input is a zip archive.
+func open(input string) (io.ReadCloser, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
+		data, err = download(input)
+	} else {
+		data, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(input), ".zip") {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", input, err)
+	}
+	for _, file := range archive.File {
+		if strings.HasSuffix(strings.ToLower(file.Name), ".txt") {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("%s: no .txt file in the archive", input)
+}
+
+func download(url string) ([]byte, error) {
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, response.Status)
+	}
+	return io.ReadAll(response.Body)
+}
@@ -1,3 +1,5 @@
 module github.com/icodealot/noaa
 
 go 1.18
+
+require go.uber.org/goleak v1.2.1
@@ -0,0 +1,505 @@
+package noaa
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hourly returns the hourly forecast for the same point as the gridpoint
+// forecast. The point is reused so no additional point lookup is made.
+func (g *GridpointForecastResponse) Hourly() (*HourlyForecastResponse, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return hourlyForecast(ctx, g.Point, configFrom(ctx).Units)
+}
+
+// Stations returns the observation stations for the same point as the gridpoint
+// forecast, nearest first. The point is reused so no additional point lookup is
+// made.
+func (g *GridpointForecastResponse) Stations() (stations *StationsResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return g.stations(ctx)
+}
+
+func (g *GridpointForecastResponse) stations(ctx context.Context) (stations *StationsResponse, err error) {
+	if g.Point == nil {
+		return nil, errors.New("the forecast has no point")
+	}
+	err = decode(ctx, g.Point.EndpointObservationStations, &stations)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// LatestObservation returns the most recent observation of the station nearest
+// to the point of the gridpoint forecast, i.e. its current conditions.
+func (g *GridpointForecastResponse) LatestObservation() (*Observation, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	stations, err := g.stations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(stations.Stations) == 0 {
+		return nil, errors.New("the point has no observation stations")
+	}
+	return latestObservation(ctx, StationID(stations.Stations[0]))
+}
+
+// IsStale reports whether the gridpoint forecast was last updated more than
+// maxAge ago. An error is returned if Updated can not be parsed.
+func (g *GridpointForecastResponse) IsStale(maxAge time.Duration) (bool, error) {
+	return isStale(g.Updated, maxAge)
+}
+
+// ActiveHazards returns the hazards of the gridpoint forecast whose valid time
+// interval contains at. Use HazardDescription to describe the returned items.
+func (g *GridpointForecastResponse) ActiveHazards(at time.Time) []HazardValueItem {
+	var hazards []HazardValueItem
+	for _, value := range g.Hazards.Values {
+		start, end, err := parseInterval(value.ValidTime)
+		if err != nil || at.Before(start) || !at.Before(end) {
+			continue
+		}
+		hazards = append(hazards, value.Value...)
+	}
+	return hazards
+}
+
+// hazardPhenomena maps the VTEC phenomenon codes used by hazards to names.
+var hazardPhenomena = map[string]string{
+	"AF": "Ashfall",
+	"AS": "Air Stagnation",
+	"BH": "Beach Hazards",
+	"BW": "Brisk Wind",
+	"BZ": "Blizzard",
+	"CF": "Coastal Flood",
+	"DF": "Debris Flow",
+	"DS": "Dust Storm",
+	"DU": "Blowing Dust",
+	"EC": "Extreme Cold",
+	"EH": "Excessive Heat",
+	"FA": "Areal Flood",
+	"FF": "Flash Flood",
+	"FG": "Dense Fog",
+	"FL": "Flood",
+	"FR": "Frost",
+	"FW": "Fire Weather",
+	"FZ": "Freeze",
+	"GL": "Gale",
+	"HF": "Hurricane Force Wind",
+	"HT": "Heat",
+	"HU": "Hurricane",
+	"HW": "High Wind",
+	"HY": "Hydrologic",
+	"HZ": "Hard Freeze",
+	"IS": "Ice Storm",
+	"LE": "Lake Effect Snow",
+	"LO": "Low Water",
+	"LS": "Lakeshore Flood",
+	"LW": "Lake Wind",
+	"MA": "Marine",
+	"MF": "Dense Fog",
+	"MH": "Ashfall",
+	"MS": "Dense Smoke",
+	"RB": "Small Craft for Rough Bar",
+	"RP": "Rip Current",
+	"SC": "Small Craft",
+	"SE": "Hazardous Seas",
+	"SI": "Small Craft for Winds",
+	"SM": "Dense Smoke",
+	"SQ": "Snow Squall",
+	"SR": "Storm",
+	"SS": "Storm Surge",
+	"SU": "High Surf",
+	"SV": "Severe Thunderstorm",
+	"SW": "Small Craft for Hazardous Seas",
+	"TO": "Tornado",
+	"TR": "Tropical Storm",
+	"TS": "Tsunami",
+	"TY": "Typhoon",
+	"UP": "Heavy Freezing Spray",
+	"WC": "Wind Chill",
+	"WI": "Wind",
+	"WS": "Winter Storm",
+	"WW": "Winter Weather",
+	"ZF": "Freezing Fog",
+	"ZR": "Freezing Rain",
+}
+
+// hazardSignificance maps the VTEC significance codes used by hazards to names.
+var hazardSignificance = map[string]string{
+	"W": "Warning",
+	"A": "Watch",
+	"Y": "Advisory",
+	"S": "Statement",
+	"F": "Forecast",
+	"O": "Outlook",
+	"N": "Synopsis",
+}
+
+// HazardDescription returns a human readable description of the VTEC codes of
+// a hazard, for example "Winter Storm Warning" for WS and W. Unknown codes are
+// returned as is, e.g. "XX.W".
+func HazardDescription(phenomenon string, significance string) string {
+	if phenomenon == "FW" && significance == "W" {
+		return "Red Flag Warning"
+	}
+	name, ok := hazardPhenomena[phenomenon]
+	level, ok2 := hazardSignificance[significance]
+	if !ok || !ok2 {
+		return phenomenon + "." + significance
+	}
+	return name + " " + level
+}
+
+// Describe returns a readable phrase for the coded weather value, for example
+// "Likely moderate rain showers" for likely, moderate, and rain_showers. Empty
+// codes are left out, and an empty string is returned if all are empty.
+func (v WeatherValueItem) Describe() string {
+	var words []string
+	for _, code := range []string{v.Coverage, v.Intensity, v.Weather} {
+		if code != "" {
+			words = append(words, strings.ReplaceAll(code, "_", " "))
+		}
+	}
+	return capitalize(strings.Join(words, " "))
+}
+
+// WeatherAt returns a readable phrase for the weather of the gridpoint forecast
+// whose valid time interval contains at, for example "Chance light rain and
+// slight chance thunderstorms". An empty string is returned if no weather is
+// forecast at that time.
+func (g *GridpointForecastResponse) WeatherAt(at time.Time) string {
+	var phrases []string
+	for _, item := range g.weatherAt(at) {
+		if phrase := item.Describe(); phrase != "" {
+			phrases = append(phrases, strings.ToLower(phrase))
+		}
+	}
+	return capitalize(strings.Join(phrases, " and "))
+}
+
+// weatherAt returns the weather values whose valid time interval contains at.
+func (g *GridpointForecastResponse) weatherAt(at time.Time) []WeatherValueItem {
+	for _, value := range g.Weather.Values {
+		start, end, err := parseInterval(value.ValidTime)
+		if err == nil && !at.Before(start) && at.Before(end) {
+			return value.Value
+		}
+	}
+	return nil
+}
+
+// capitalize returns s with its first letter in upper case.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// ValueAt returns the value of the series whose valid time interval contains
+// t. False is returned if no interval contains t.
+func (s *GridpointForecastTimeSeries) ValueAt(t time.Time) (float64, bool) {
+	return s.intervals().valueAt(t)
+}
+
+// TotalPrecipitation returns the total quantitative precipitation forecast
+// between start and end along with its unit of measure, usually wmoUnit:mm.
+// Intervals that are partially inside the window are prorated, assuming that
+// the amount of an interval falls evenly over its duration.
+func (g *GridpointForecastResponse) TotalPrecipitation(start time.Time, end time.Time) (float64, string) {
+	total := 0.0
+	for _, i := range g.QuantitativePrecipitation.intervals() {
+		from, to := i.start, i.end
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if !to.After(from) || !i.end.After(i.start) {
+			continue
+		}
+		total += i.value * float64(to.Sub(from)) / float64(i.end.Sub(i.start))
+	}
+	return total, g.QuantitativePrecipitation.Uom
+}
+
+// PrecipTypeAt classifies the precipitation forecast at t as "rain", "snow",
+// "sleet", "freezing_rain", "mix" (more than one type), or "none". The API
+// has no single value for this so it is derived with a heuristic from the
+// series whose valid time interval contains t:
+//
+//   - a snowfall amount means snow, and rain too if the temperature is above
+//     2°C, where snow melts before it accumulates much
+//   - an ice accumulation means freezing rain
+//   - sleet in the weather series means sleet
+//   - any other quantitative precipitation means freezing rain at or below
+//     0°C and rain otherwise
+//
+// "none" is returned if no precipitation, snow, or ice is forecast at t.
+func (g *GridpointForecastResponse) PrecipTypeAt(t time.Time) string {
+	temperature, hasTemperature := g.Temperature.ValueAt(t)
+	if f, ok := conversions[[2]string{g.Temperature.Uom, unitDegC}]; ok && hasTemperature {
+		temperature = f(temperature)
+	}
+	var types []string
+	if snow, _ := g.SnowfallAmount.ValueAt(t); snow > 0 {
+		types = append(types, "snow")
+		if hasTemperature && temperature > 2 {
+			types = append(types, "rain")
+		}
+	}
+	if ice, _ := g.IceAccumulation.ValueAt(t); ice > 0 {
+		types = append(types, "freezing_rain")
+	}
+	for _, item := range g.weatherAt(t) {
+		if item.Weather == "sleet" {
+			types = append(types, "sleet")
+			break
+		}
+	}
+	if precipitation, _ := g.QuantitativePrecipitation.ValueAt(t); precipitation > 0 && len(types) == 0 {
+		if hasTemperature && temperature <= 0 {
+			types = append(types, "freezing_rain")
+		} else {
+			types = append(types, "rain")
+		}
+	}
+	switch len(types) {
+	case 0:
+		return "none"
+	case 1:
+		return types[0]
+	}
+	return "mix"
+}
+
+// MarineConditions holds the sea-state values of a gridpoint forecast at a point
+// in time. Heights are in the unit of the series, usually wmoUnit:m, periods in
+// seconds, and directions in degrees. OK is false if the gridpoint has no wave
+// or swell data at that time, e.g. because it is not over water.
+type MarineConditions struct {
+	WaveHeight              float64
+	WavePeriod              float64
+	WaveDirection           float64
+	WindWaveHeight          float64
+	PrimarySwellHeight      float64
+	PrimarySwellDirection   float64
+	SecondarySwellHeight    float64
+	SecondarySwellDirection float64
+	OK                      bool
+}
+
+// IsMarine reports whether the gridpoint forecast is for a marine or coastal
+// grid, i.e. whether its wave height series has any values.
+func (g *GridpointForecastResponse) IsMarine() bool {
+	return len(g.WaveHeight.Values) > 0
+}
+
+// MarineConditionsAt returns the wave and swell values of the gridpoint
+// forecast whose valid time interval contains t.
+func (g *GridpointForecastResponse) MarineConditionsAt(t time.Time) MarineConditions {
+	var m MarineConditions
+	for _, v := range []struct {
+		series *GridpointForecastTimeSeries
+		value  *float64
+	}{
+		{&g.WaveHeight, &m.WaveHeight},
+		{&g.WavePeriod, &m.WavePeriod},
+		{&g.WaveDirection, &m.WaveDirection},
+		{&g.WindWaveHeight, &m.WindWaveHeight},
+		{&g.PrimarySwellHeight, &m.PrimarySwellHeight},
+		{&g.PrimarySwellDirection, &m.PrimarySwellDirection},
+		{&g.SecondarySwellHeight, &m.SecondarySwellHeight},
+		{&g.SecondarySwellDirection, &m.SecondarySwellDirection},
+	} {
+		if value, ok := v.series.ValueAt(t); ok {
+			*v.value = value
+			m.OK = true
+		}
+	}
+	if !m.OK {
+		return MarineConditions{}
+	}
+	return m
+}
+
+// interval is a parsed value of a GridpointForecastTimeSeries.
+type interval struct {
+	start time.Time
+	end   time.Time
+	value float64
+}
+
+type intervals []interval
+
+// intervals parses the valid times of the series, skipping invalid ones.
+func (s *GridpointForecastTimeSeries) intervals() intervals {
+	parsed := make(intervals, 0, len(s.Values))
+	for _, value := range s.Values {
+		start, end, err := parseInterval(value.ValidTime)
+		if err == nil {
+			parsed = append(parsed, interval{start, end, value.Value})
+		}
+	}
+	return parsed
+}
+
+func (in intervals) valueAt(t time.Time) (float64, bool) {
+	for _, i := range in {
+		if !t.Before(i.start) && t.Before(i.end) {
+			return i.value, true
+		}
+	}
+	return 0, false
+}
+
+// series returns the time series of the gridpoint forecast keyed by their JSON
+// name, for example "temperature" or "probabilityOfPrecipitation".
+func (g *GridpointForecastResponse) series() map[string]*GridpointForecastTimeSeries {
+	series := map[string]*GridpointForecastTimeSeries{}
+	v := reflect.ValueOf(g).Elem()
+	seriesType := reflect.TypeOf(GridpointForecastTimeSeries{})
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Type != seriesType {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		series[name] = v.Field(i).Addr().Interface().(*GridpointForecastTimeSeries)
+	}
+	return series
+}
+
+// Select returns a copy of the gridpoint forecast with only the named series,
+// by JSON name such as "temperature" or "probabilityOfPrecipitation", and the
+// other fields populated, e.g. to reduce the memory used when caching many
+// forecasts. "weather" and "hazards" can be selected too. Unknown names are
+// ignored with a logged warning.
+func (g *GridpointForecastResponse) Select(params ...string) *GridpointForecastResponse {
+	selected := make(map[string]bool, len(params))
+	for _, param := range params {
+		selected[param] = true
+	}
+
+	c := *g
+	series := c.series()
+	for name, s := range series {
+		if !selected[name] {
+			*s = GridpointForecastTimeSeries{}
+		}
+	}
+	if !selected["weather"] {
+		c.Weather = Weather{}
+	}
+	if !selected["hazards"] {
+		c.Hazards = Hazard{}
+	}
+
+	cfg := snapshotConfig()
+	for _, param := range params {
+		if _, ok := series[param]; !ok && param != "weather" && param != "hazards" {
+			cfg.logf("ignoring unknown gridpoint parameter %q", param)
+		}
+	}
+	return &c
+}
+
+// GridpointRow holds the values of every gridpoint series at a point in time
+// keyed by JSON name, for example "temperature". Series without a value at
+// that time are left out.
+type GridpointRow struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// ToTable resamples all of the series of the gridpoint forecast onto a common
+// time grid with the given step (hourly if step is not positive) and returns
+// one row per step. The grid spans from the earliest to the latest valid time
+// of any series, starting at a multiple of step.
+func (g *GridpointForecastResponse) ToTable(step time.Duration) []GridpointRow {
+	if step <= 0 {
+		step = time.Hour
+	}
+
+	var first, last time.Time
+	parsed := map[string]intervals{}
+	for name, s := range g.series() {
+		parsed[name] = s.intervals()
+		for _, i := range parsed[name] {
+			if first.IsZero() || i.start.Before(first) {
+				first = i.start
+			}
+			if i.end.After(last) {
+				last = i.end
+			}
+		}
+	}
+	if first.IsZero() {
+		return nil
+	}
+
+	var rows []GridpointRow
+	for t := first.Truncate(step); t.Before(last); t = t.Add(step) {
+		row := GridpointRow{Time: t, Values: map[string]float64{}}
+		for name, in := range parsed {
+			if value, ok := in.valueAt(t); ok {
+				row.Values[name] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// DefaultCSVParams are the gridpoint series written by WriteForecastCSV when no
+// params are given.
+var DefaultCSVParams = []string{"temperature", "probabilityOfPrecipitation", "quantitativePrecipitation", "windSpeed"}
+
+// WriteForecastCSV writes the hourly values of the given gridpoint series to w
+// as CSV. The header row holds "time" followed by params, the JSON names of the
+// series (DefaultCSVParams if empty), and each data row holds an RFC 3339 time
+// followed by the values. Missing values are written as empty fields.
+func WriteForecastCSV(w io.Writer, g *GridpointForecastResponse, params []string) error {
+	if len(params) == 0 {
+		params = DefaultCSVParams
+	}
+	series := g.series()
+	for _, param := range params {
+		if _, ok := series[param]; !ok {
+			return fmt.Errorf("unknown gridpoint parameter %q", param)
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(append([]string{"time"}, params...)); err != nil {
+		return err
+	}
+	for _, row := range g.ToTable(time.Hour) {
+		record := []string{row.Time.Format(time.RFC3339)}
+		for _, param := range params {
+			field := ""
+			if value, ok := row.Values[param]; ok {
+				field = strconv.FormatFloat(value, 'f', -1, 64)
+			}
+			record = append(record, field)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
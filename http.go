@@ -1,51 +1,509 @@
 package noaa
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Make an HTTP GET request to the provided endpoint and then attempts
 // to decode the HTTP response into the provided reference. The caller
 // must ensure that the type reference provided matches the JSON
-// returned by the provided endpoint uri
-func decode(endpoint string, v any) error {
-	res, err := get(endpoint)
-	if err != nil {
+// returned by the provided endpoint uri. GeoJSON responses are first
+// converted to the JSON-LD shape the types are mapped to. If another
+// format than JSON-LD fails to decode or is not acceptable (406), the
+// request is retried once as JSON-LD, see SetAcceptFallback.
+func decode(ctx context.Context, endpoint string, v any) error {
+	cfg := configFrom(ctx)
+	if cfg.Accept == string(AcceptCAP) {
+		return errors.New("responses in application/cap+xml can not be decoded, use Raw instead")
+	}
+	received, err := decodeAccept(ctx, endpoint, v)
+	if err == nil || cfg.DisableAcceptFallback || strings.Contains(cfg.Accept, "ld+json") {
 		return err
 	}
+	var apiErr *APIError
+	if !received && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotAcceptable) {
+		return err
+	}
+
+	// retry once with the format that every endpoint supports
+	if cfg.Logger != nil {
+		cfg.Logger.Printf("noaa: %s as %s failed, falling back to %s: %v", endpoint, cfg.Accept, AcceptLDJSON, err)
+	}
+	fallback := *cfg
+	fallback.Accept = string(AcceptLDJSON)
+	target := reflect.ValueOf(v).Elem()
+	target.Set(reflect.Zero(target.Type()))
+	_, err = decodeAccept(withConfig(ctx, &fallback), endpoint, v)
+	return err
+}
+
+// decodeAccept requests endpoint with the Accept header of the config of ctx
+// and decodes the response into v. received reports whether a response body
+// was read, in which case a non-nil err is an error decoding it.
+func decodeAccept(ctx context.Context, endpoint string, v any) (received bool, err error) {
+	cfg := configFrom(ctx)
+	res, err := get(ctx, endpoint)
+	if err != nil {
+		return false, err
+	}
 	defer res.Body.Close()
 
-	decoder := json.NewDecoder(res.Body)
-	if err = decoder.Decode(v); err != nil {
+	data, err := readBody(res.Body, cfg.MaxResponseBytes)
+	if err != nil {
+		return false, err
+	}
+	if strings.Contains(cfg.Accept, "geo+json") {
+		if data, err = fromGeoJSON(data); err != nil {
+			return true, err
+		}
+	}
+	if !cfg.StrictDecoding {
+		return true, json.Unmarshal(data, v)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return true, decoder.Decode(v)
+}
+
+// Raw makes a request to endpoint with the configured headers and returns the
+// response body as is, for example the CAP (XML) of an alerts endpoint such as
+// https://api.weather.gov/alerts/active/area/IL with AcceptCAP.
+func Raw(endpoint string) ([]byte, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	res, err := get(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return readBody(res.Body, configFrom(ctx).MaxResponseBytes)
+}
+
+// Ping checks that the API is reachable with the configured client and headers
+// by requesting the API root, which returns a small status document. It makes
+// a single attempt without retries so that it is suitable for readiness
+// probes. A nil error is returned if the API responded with a 200.
+func Ping(ctx context.Context) error {
+	ctx, cfg := callConfig(ctx)
+	res, err := getOnce(ctx, cfg.apiURL()+"/")
+	if err != nil {
 		return err
 	}
-	return nil
+	return res.Body.Close()
 }
 
-// HTTP GET the noaa endpoint provided. We could just use http.Get() but
-// this helps since we include some custom header values
-func get(endpoint string) (res *http.Response, err error) {
-	req, err := http.NewRequest("GET", endpoint, nil)
+// Close releases the resources held by the package for the configured Client
+// by closing its idle connections, e.g. before a long running service discards
+// its configuration. Any Doer with a CloseIdleConnections method, such as an
+// *http.Client, is supported. The package remains usable after Close; new
+// connections are opened as needed.
+func Close() {
+	configMu.RLock()
+	client := config.Client
+	configMu.RUnlock()
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if c, ok := client.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// rawResponse is the last response recorded for an endpoint in debug mode.
+type rawResponse struct {
+	body   []byte
+	status int
+}
+
+var (
+	rawResponsesMu sync.Mutex
+	rawResponses   = map[string]rawResponse{}
+)
+
+// LastRawResponse returns the body and status code of the last response from
+// endpoint recorded while debug mode was enabled with SetDebug. A nil body and
+// zero status are returned if no response has been recorded.
+func LastRawResponse(endpoint string) ([]byte, int) {
+	rawResponsesMu.Lock()
+	defer rawResponsesMu.Unlock()
+	r := rawResponses[endpoint]
+	return r.body, r.status
+}
+
+// recordingBody copies everything read from a response body and records it as
+// the last raw response of the endpoint when the body is closed.
+type recordingBody struct {
+	io.ReadCloser
+	endpoint string
+	status   int
+	buf      bytes.Buffer
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	return io.TeeReader(b.ReadCloser, &b.buf).Read(p)
+}
+
+func (b *recordingBody) Close() error {
+	rawResponsesMu.Lock()
+	rawResponses[b.endpoint] = rawResponse{body: b.buf.Bytes(), status: b.status}
+	rawResponsesMu.Unlock()
+	return b.ReadCloser.Close()
+}
+
+// observedBody counts the bytes read from a response body and calls the
+// OnResponse hook when the body is closed.
+type observedBody struct {
+	io.ReadCloser
+	endpoint string
+	status   int
+	bytes    int
+	start    time.Time
+	hook     func(endpoint string, status int, bytes int, dur time.Duration)
+}
+
+func (b *observedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += n
+	return n, err
+}
+
+func (b *observedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.hook != nil {
+		b.hook(b.endpoint, b.status, b.bytes, time.Since(b.start))
+		b.hook = nil // only report the first Close
+	}
+	return err
+}
+
+// ErrResponseTooLarge is returned when a response body is larger than
+// Config.MaxResponseBytes.
+var ErrResponseTooLarge = errors.New("response body is too large")
+
+// readBody reads the response body up to limit, Config.MaxResponseBytes, so
+// that a misconfigured endpoint can not exhaust memory.
+func readBody(body io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
 	if err != nil {
 		return nil, err
 	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, limit)
+	}
+	return data, nil
+}
+
+// fromGeoJSON converts a GeoJSON response into the equivalent JSON-LD shape.
+// A Feature is unwrapped to its properties and the features of a
+// FeatureCollection become the "@graph" of the collection, keeping any other
+// members such as "pagination". Anything else is returned unchanged.
+func fromGeoJSON(data []byte) ([]byte, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if properties, ok := envelope["properties"]; ok {
+		return properties, nil
+	}
+	features, ok := envelope["features"]
+	if !ok {
+		return data, nil
+	}
+
+	var collection []struct {
+		Properties json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(features, &collection); err != nil {
+		return nil, err
+	}
+	graph := make([]json.RawMessage, 0, len(collection))
+	for _, feature := range collection {
+		graph = append(graph, feature.Properties)
+	}
+	delete(envelope, "features")
+	graphData, err := json.Marshal(graph)
+	if err != nil {
+		return nil, err
+	}
+	envelope["@graph"] = graphData
+	return json.Marshal(envelope)
+}
+
+// HTTP GET the noaa endpoint provided. We could just use http.Get() but
+// this helps since we include some custom header values. Failed requests
+// are retried according to Config.Retries and Config.RetryDelay.
+func get(ctx context.Context, endpoint string) (res *http.Response, err error) {
+	cfg := configFrom(ctx)
+	if !breaker.allow(cfg) {
+		return nil, ErrCircuitOpen
+	}
+	// record the result on every return so that a probe is always released
+	result := resultNone
+	defer func() { breaker.record(cfg, result) }()
+	for attempt := 0; ; attempt++ {
+		res, err = getOnce(ctx, endpoint)
+		if err == nil {
+			result = resultOK
+			return res, nil
+		}
+		retryable := isRetryable(ctx, res, err)
+		if attempt >= cfg.Retries || !retryable {
+			if ctx.Err() == nil {
+				result = resultOK // the API responded, e.g. with a 404
+				if retryable {
+					result = resultFailed
+				}
+			}
+			return nil, err
+		}
+		if err = sleep(ctx, backoff(cfg, attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
 
-	req.Header.Add("Accept", config.Accept)
-	req.Header.Add("User-Agent", config.UserAgent)
+// getOnce makes a single attempt at the request. A non-nil response is only
+// returned alongside an error when the API returned a non-200 status.
+func getOnce(ctx context.Context, endpoint string) (res *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, requestError{err}
+	}
+	cfg := configFrom(ctx)
 
-	// enable quantitative values in forecast responses
-	req.Header.Add("feature-flags", "forecast_temperature_qv, forecast_wind_speed_qv")
+	req.Header.Add("Accept", cfg.Accept)
+	req.Header.Add("User-Agent", cfg.UserAgent)
+	if cfg.AcceptLanguage != "" {
+		req.Header.Add("Accept-Language", cfg.AcceptLanguage)
+	}
 
-	res, err = http.DefaultClient.Do(req)
+	// enable quantitative values in forecast responses unless overridden
+	if flags := featureFlags(ctx); len(flags) > 0 {
+		req.Header.Add("feature-flags", strings.Join(flags, ", "))
+	}
+
+	for key, value := range cfg.ExtraHeaders {
+		req.Header.Set(key, value)
+	}
+
+	// resolve the default client locally, cfg may be shared by other requests
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if c, ok := client.(*http.Client); ok && cfg.DisableRedirects {
+		noRedirects := *c
+		noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		client = &noRedirects
+	}
+
+	start := time.Now()
+	res, err = client.Do(req)
 	if err != nil {
+		if cfg.OnResponse != nil {
+			cfg.OnResponse(endpoint, 0, 0, time.Since(start))
+		}
 		return nil, err
 	}
 
+	if cfg.OnResponse != nil {
+		res.Body = &observedBody{ReadCloser: res.Body, endpoint: endpoint, status: res.StatusCode, start: start, hook: cfg.OnResponse}
+	}
+
+	if cfg.Debug {
+		res.Body = &recordingBody{ReadCloser: res.Body, endpoint: endpoint, status: res.StatusCode}
+	}
+
 	if res.StatusCode != http.StatusOK {
-		return nil, errors.New(fmt.Sprintf("%d %s", res.StatusCode, res.Status))
+		if cfg.Debug {
+			readBody(res.Body, cfg.MaxResponseBytes)
+		}
+		res.Body.Close()
+		return res, newAPIError(endpoint, res)
 	}
 	return res, nil
 }
+
+// APIError is returned when the API responds with a status other than 200 OK.
+// URL is the endpoint that was requested and FinalURL is the URL of the last
+// request made when redirects were followed. Location is set for redirects
+// that were not followed, see SetFollowRedirects.
+type APIError struct {
+	StatusCode int
+	Status     string
+	URL        string
+	FinalURL   string
+	Location   string
+}
+
+func newAPIError(endpoint string, res *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		URL:        endpoint,
+		FinalURL:   endpoint,
+		Location:   res.Header.Get("Location"),
+	}
+	if res.Request != nil && res.Request.URL != nil {
+		apiErr.FinalURL = res.Request.URL.String()
+	}
+	return apiErr
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s: GET %s", e.Status, e.URL)
+	if e.FinalURL != e.URL {
+		msg += fmt.Sprintf(" (redirected to %s)", e.FinalURL)
+	}
+	if e.Location != "" {
+		msg += fmt.Sprintf(" (redirect to %s not followed)", e.Location)
+	}
+	return msg
+}
+
+// ErrCircuitOpen is returned without making a request while the circuit
+// breaker is open, see SetCircuitBreaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open, the api is failing")
+
+// circuitBreaker counts consecutive failed requests, see SetCircuitBreaker.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var breaker circuitBreaker
+
+// allow reports whether a request may be made. Once the cooldown has passed a
+// single probe request is allowed until its result is recorded.
+func (b *circuitBreaker) allow(cfg *Config) bool {
+	if cfg.CircuitThreshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < cfg.CircuitThreshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// result is the outcome of a request recorded by the circuit breaker.
+type result int
+
+const (
+	resultNone   result = iota // canceled, which says nothing about the API
+	resultOK                   // the API responded
+	resultFailed               // a failure that would be retried, see isRetryable
+)
+
+// reset closes the circuit breaker.
+func (b *circuitBreaker) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures, b.openUntil, b.probing = 0, time.Time{}, false
+}
+
+// record records the result of a request that was allowed. Only failures
+// that would be retried, see isRetryable, count towards opening the breaker. A
+// request without a result, such as a canceled probe, leaves the breaker as it
+// was and lets another request probe the API.
+func (b *circuitBreaker) record(cfg *Config, r result) {
+	if cfg.CircuitThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	switch r {
+	case resultNone:
+		return
+	case resultOK:
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= cfg.CircuitThreshold {
+		b.openUntil = time.Now().Add(cfg.CircuitCooldown)
+		cfg.logf("circuit breaker opened after %d failed requests", b.failures)
+	}
+}
+
+// requestError is an error creating a request, such as an invalid endpoint
+// URL, which fails the same way every time it is retried.
+type requestError struct {
+	err error
+}
+
+func (e requestError) Error() string { return e.err.Error() }
+func (e requestError) Unwrap() error { return e.err }
+
+// isRetryable reports whether a failed request might succeed if retried. The
+// API is prone to transient 5xx errors and rate limiting.
+func isRetryable(ctx context.Context, res *http.Response, err error) bool {
+	if ctx.Err() != nil || errors.As(err, &requestError{}) {
+		return false
+	}
+	if res == nil {
+		return true // network error
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// SetJitterSource changes the source of the random retry delays used when
+// RetryJitter is enabled, e.g. to make the delays deterministic in tests.
+func SetJitterSource(src rand.Source) {
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	jitterRand = rand.New(src)
+}
+
+// backoff returns the delay before the given retry attempt, doubling
+// Config.RetryDelay for each attempt, with full jitter if enabled.
+func backoff(cfg *Config, attempt int) time.Duration {
+	delay := cfg.RetryDelay << attempt
+	if !cfg.RetryJitter || delay <= 0 {
+		return delay
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(delay) + 1))
+}
+
+// sleep waits for the given delay or until the context is done.
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
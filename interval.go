@@ -0,0 +1,92 @@
+package noaa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseInterval parses an ISO 8601 time interval as used by the validTime and
+// validTimes values of the API, e.g. 2019-07-04T18:00:00+00:00/PT3H. Intervals
+// may be given as start/duration, start/end, or duration/end.
+func parseInterval(interval string) (start time.Time, end time.Time, err error) {
+	first, second, ok := strings.Cut(interval, "/")
+	if !ok {
+		return start, end, fmt.Errorf("invalid time interval %q", interval)
+	}
+	switch {
+	case strings.HasPrefix(second, "P"):
+		if start, err = time.Parse(time.RFC3339, first); err != nil {
+			return start, end, err
+		}
+		end, err = addISODuration(start, second, 1)
+	case strings.HasPrefix(first, "P"):
+		if end, err = time.Parse(time.RFC3339, second); err != nil {
+			return start, end, err
+		}
+		start, err = addISODuration(end, first, -1)
+	default:
+		if start, err = time.Parse(time.RFC3339, first); err != nil {
+			return start, end, err
+		}
+		end, err = time.Parse(time.RFC3339, second)
+	}
+	return start, end, err
+}
+
+// addISODuration adds (sign 1) or subtracts (sign -1) an ISO 8601 duration such
+// as P7DT11H to t. Years, months, weeks, and days are calendar based.
+func addISODuration(t time.Time, duration string, sign int) (time.Time, error) {
+	invalid := fmt.Errorf("invalid duration %q", duration)
+	if !strings.HasPrefix(duration, "P") || len(duration) < 3 {
+		return t, invalid
+	}
+	var years, months, days int
+	var clock time.Duration
+	inTime := false
+	number := ""
+	for _, r := range duration[1:] {
+		switch {
+		case r >= '0' && r <= '9' || r == '.':
+			number += string(r)
+			continue
+		case r == 'T':
+			if inTime || number != "" {
+				return t, invalid
+			}
+			inTime = true
+			continue
+		}
+		if number == "" {
+			return t, invalid
+		}
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return t, invalid
+		}
+		number = ""
+		switch {
+		case !inTime && r == 'Y':
+			years = int(value)
+		case !inTime && r == 'M':
+			months = int(value)
+		case !inTime && r == 'W':
+			days += 7 * int(value)
+		case !inTime && r == 'D':
+			days += int(value)
+		case inTime && r == 'H':
+			clock += time.Duration(value * float64(time.Hour))
+		case inTime && r == 'M':
+			clock += time.Duration(value * float64(time.Minute))
+		case inTime && r == 'S':
+			clock += time.Duration(value * float64(time.Second))
+		default:
+			return t, invalid
+		}
+	}
+	if number != "" {
+		return t, invalid
+	}
+	return t.AddDate(sign*years, sign*months, sign*days).Add(time.Duration(sign) * clock), nil
+}
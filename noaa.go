@@ -3,33 +3,250 @@
 // by the National Weather Service, an agency of the United States.
 package noaa
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
 
 // Cache used for point lookup to save some HTTP round trips
 // key is expected to be PointsResponse.ID
 var pointsCache = map[string]*PointsResponse{}
 
+// notFoundPoint is a point lookup that returned a 404, cached until expires.
+type notFoundPoint struct {
+	err     error
+	expires time.Time
+}
+
+// Cache of point lookups outside of the API's coverage, see SetNegativeCacheTTL
+var notFoundPoints = map[string]notFoundPoint{}
+
+// Point lookups in flight, keyed by endpoint, shared by concurrent callers.
+var pointsFetches = map[string]*pointsFetch{}
+
+// guards pointsCache, notFoundPoints, pointsFetches and the waiters of each fetch
+var pointsMu sync.Mutex
+
 // Points returns a reference to a PointsResponse (cached if appropriate)
 // which contains useful noaa endpoints for a given <lat,lon> to use in
 // subsequent calls to the api
 func Points(lat string, lon string) (points *PointsResponse, err error) {
-	endpoint := config.endpointPoints(lat, lon)
-	if pointsCache[endpoint] != nil {
-		return pointsCache[endpoint], nil
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return PointsContext(ctx, lat, lon)
+}
+
+// PointsContext is like Points but uses the provided context for the request.
+// Concurrent lookups of the same point share a single request, made with the
+// config of the first caller. Canceling the context of a caller only stops it
+// from waiting; the request continues for the other callers, bounded by
+// Config.DefaultTimeout if set, and is canceled once no callers are left.
+func PointsContext(ctx context.Context, lat string, lon string) (points *PointsResponse, err error) {
+	ctx, cfg := callConfig(ctx)
+	if cfg.StrictCoordinates {
+		if err := checkCoordinates(lat, lon); err != nil {
+			return nil, err
+		}
+	}
+	endpoint := cfg.endpointPoints(lat, lon)
+	if points, ok, err := cachedPoint(endpoint); ok {
+		return points, err
+	}
+	pointsMu.Lock()
+	fetch := pointsFetches[endpoint]
+	if fetch == nil {
+		fetchCtx, cancel := context.WithCancel(detachedContext{ctx})
+		if cfg.DefaultTimeout > 0 {
+			fetchCtx, cancel = context.WithTimeout(detachedContext{ctx}, cfg.DefaultTimeout)
+		}
+		fetch = &pointsFetch{done: make(chan struct{}), cancel: cancel}
+		pointsFetches[endpoint] = fetch
+		go fetch.run(fetchCtx, endpoint)
+	}
+	fetch.waiters++
+	pointsMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		fetch.leave(endpoint)
+		return nil, ctx.Err()
+	case <-fetch.done:
+		return fetch.points, fetch.err
+	}
+}
+
+// pointsFetch is a point lookup shared by the callers waiting for it. The
+// request is canceled once every caller has stopped waiting.
+type pointsFetch struct {
+	done    chan struct{} // closed once points and err are set
+	points  *PointsResponse
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func (f *pointsFetch) run(ctx context.Context, endpoint string) {
+	defer f.cancel()
+	f.points, f.err = fetchPoint(ctx, endpoint)
+	pointsMu.Lock()
+	if pointsFetches[endpoint] == f {
+		delete(pointsFetches, endpoint)
 	}
-	err = decode(endpoint, &points)
+	pointsMu.Unlock()
+	close(f.done)
+}
+
+// leave stops waiting for the fetch, canceling it if no callers are left so
+// that the next lookup of endpoint starts a new request.
+func (f *pointsFetch) leave(endpoint string) {
+	pointsMu.Lock()
+	defer pointsMu.Unlock()
+	f.waiters--
+	if f.waiters == 0 {
+		f.cancel()
+		if pointsFetches[endpoint] == f {
+			delete(pointsFetches, endpoint)
+		}
+	}
+}
+
+// detachedContext keeps the values of a context, such as its config, but not
+// its deadline or cancellation, so that a request shared by several callers is
+// not canceled by one of them.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// cachedPoint returns the cached point or 404 error for endpoint. False is
+// returned if neither is cached.
+func cachedPoint(endpoint string) (points *PointsResponse, ok bool, err error) {
+	pointsMu.Lock()
+	defer pointsMu.Unlock()
+	if points := pointsCache[endpoint]; points != nil {
+		return points, true, nil
+	}
+	if cached, ok := notFoundPoints[endpoint]; ok {
+		if time.Now().Before(cached.expires) {
+			return nil, true, cached.err
+		}
+		delete(notFoundPoints, endpoint)
+	}
+	return nil, false, nil
+}
+
+// fetchPoint requests the point at endpoint and caches the result.
+func fetchPoint(ctx context.Context, endpoint string) (points *PointsResponse, err error) {
+	err = decode(ctx, endpoint, &points)
+	ttl := configFrom(ctx).NegativeCacheTTL
+	pointsMu.Lock()
+	defer pointsMu.Unlock()
 	if err != nil {
+		if ttl > 0 && IsOutsideUS(err) {
+			notFoundPoints[endpoint] = notFoundPoint{err: err, expires: time.Now().Add(ttl)}
+		}
 		return nil, err
 	}
 	pointsCache[endpoint] = points
 	return
 }
 
+// Endpoints returns the URLs that the forecast and stations functions will
+// request for a given <lat,lon> without fetching them, including the query of
+// the configured units. Only the (cached) point lookup is made. This is useful
+// for debugging and allowlisting egress.
+func Endpoints(lat string, lon string) (endpoints map[string]string, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	ctx, cfg := callConfig(ctx)
+	point, err := PointsContext(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"points":              cfg.endpointPoints(lat, lon),
+		"forecast":            withUnits(point.EndpointForecast, cfg.Units),
+		"forecastHourly":      withUnits(point.EndpointForecastHourly, cfg.Units),
+		"forecastGridData":    withUnits(point.EndpointForecastGridData, cfg.Units),
+		"observationStations": point.EndpointObservationStations,
+	}, nil
+}
+
 // Office returns a reference to a OfficeResponse which contains details
 // for a specific forecast office identified by ID
 // For example, https://api.weather.gov/offices/LOT (Chicago)
 func Office(id string) (office *OfficeResponse, err error) {
-	err = decode(config.endpointOffices(id), &office)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return officeContext(ctx, id)
+}
+
+func officeContext(ctx context.Context, id string) (office *OfficeResponse, err error) {
+	err = decode(ctx, configFrom(ctx).endpointOffices(id), &office)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// OfficeForPoint returns the details of the forecast office responsible for
+// a given <lat,lon>, identified by the CWA of the (cached) point lookup.
+func OfficeForPoint(lat string, lon string) (office *OfficeResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	point, err := PointsContext(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	return officeContext(ctx, point.CWA)
+}
+
+// ForecastDiscussion returns the text of the latest Area Forecast Discussion
+// (AFD) issued by the forecast office responsible for a given <lat,lon>, in
+// which forecasters explain the reasoning behind the forecast. The office is
+// identified by the CWA of the (cached) point lookup.
+func ForecastDiscussion(lat string, lon string) (string, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	point, err := PointsContext(ctx, lat, lon)
+	if err != nil {
+		return "", err
+	}
+	cfg := configFrom(ctx)
+	var products *ProductsResponse
+	err = decode(ctx, cfg.endpointProducts("AFD", point.CWA), &products)
+	if err != nil {
+		return "", err
+	}
+	if len(products.Products) == 0 {
+		return "", fmt.Errorf("no forecast discussion issued by %s", point.CWA)
+	}
+	var product *Product
+	err = decode(ctx, cfg.endpointProduct(products.Products[0].ID), &product)
+	if err != nil {
+		return "", err
+	}
+	return product.ProductText, nil
+}
+
+// AlertsActiveCount returns a reference to an AlertsCount which contains the
+// number of active alerts in total and broken down by zone, area, and region.
+// This is much cheaper than fetching every active alert.
+func AlertsActiveCount() (count *AlertsCount, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	err = decode(ctx, configFrom(ctx).endpointAlertsActiveCount(), &count)
 	if err != nil {
 		return nil, err
 	}
@@ -38,39 +255,517 @@ func Office(id string) (office *OfficeResponse, err error) {
 
 // Stations returns an array of observation station IDs (urls)
 func Stations(lat string, lon string) (stations *StationsResponse, err error) {
-	point, err := Points(lat, lon)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return StationsContext(ctx, lat, lon)
+}
+
+// StationsContext is like Stations but uses the provided context for the
+// point lookup and the stations request.
+func StationsContext(ctx context.Context, lat string, lon string) (stations *StationsResponse, err error) {
+	ctx, _ = callConfig(ctx)
+	point, err := PointsContext(ctx, lat, lon)
 	if err != nil {
 		return nil, err
 	}
-	err = decode(point.EndpointObservationStations, &stations)
+	err = decode(ctx, point.EndpointObservationStations, &stations)
 	if err != nil {
 		return nil, err
 	}
 	return
 }
 
-// Forecast returns an array of forecast observations (14 periods and 2/day max)
-func Forecast(lat string, lon string) (forecast *ForecastResponse, err error) {
-	point, err := Points(lat, lon)
+// AlertQuery filters the alerts returned by Alerts. Zero fields are ignored.
+type AlertQuery struct {
+	Start time.Time // alerts sent at or after Start
+	End   time.Time // alerts sent at or before End
+	Area  []string  // state or marine area codes, e.g. "IL"
+	Zone  []string  // zone IDs, e.g. "ILZ014"
+	Event []string  // event names, e.g. "Tornado Warning"
+	Limit int       // alerts per page
+}
+
+// values returns the query parameters of q for the /alerts endpoint.
+func (q AlertQuery) values() url.Values {
+	params := url.Values{}
+	if !q.Start.IsZero() {
+		params.Set("start", q.Start.UTC().Format(time.RFC3339))
+	}
+	if !q.End.IsZero() {
+		params.Set("end", q.End.UTC().Format(time.RFC3339))
+	}
+	if len(q.Area) > 0 {
+		params.Set("area", strings.ToUpper(strings.Join(q.Area, ",")))
+	}
+	if len(q.Zone) > 0 {
+		params.Set("zone", strings.ToUpper(strings.Join(q.Zone, ",")))
+	}
+	if len(q.Event) > 0 {
+		params.Set("event", strings.Join(q.Event, ","))
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return params
+}
+
+// Alerts returns the alerts matching q, including historical alerts that are
+// no longer active. Every page of the response is requested and combined
+// unless the number of pages is capped with SetMaxPages.
+func Alerts(q AlertQuery) (alerts *AlertsResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	endpoint, err := withQuery(configFrom(ctx).endpointAlerts(), q.values())
+	if err != nil {
+		return nil, err
+	}
+	return decodePages[AlertsResponse](ctx, endpoint, 0)
+}
+
+// AlertsForArea returns the active alerts for an area identified by its two
+// letter code, either a state such as "IL" or a marine area such as "GM". An
+// error is returned without calling the API if the code is not two letters.
+func AlertsForArea(area string) (alerts *AlertsResponse, err error) {
+	code := strings.ToUpper(area)
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return nil, fmt.Errorf("%q is not a two letter area code", area)
+	}
+	ctx, cancel := defaultContext()
+	defer cancel()
+	err = decode(ctx, configFrom(ctx).endpointAlertsActiveArea(code), &alerts)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// StationID returns the station ID from a station URL as returned by the API,
+// for example "KORD" from https://api.weather.gov/stations/KORD. This is the
+// ID expected by Observations. Strings that are not URLs are returned as is.
+func StationID(url string) string {
+	id := strings.TrimRight(url, "/")
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		id = id[i+1:]
+	}
+	return id
+}
+
+// Station returns the metadata of the observation station identified by ID,
+// for example "KORD", including its name and location.
+func Station(stationID string) (station *StationResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return stationContext(ctx, stationID)
+}
+
+func stationContext(ctx context.Context, stationID string) (station *StationResponse, err error) {
+	err = decode(ctx, configFrom(ctx).endpointStation(stationID), &station)
 	if err != nil {
 		return nil, err
 	}
-	err = decode(point.EndpointForecast+config.getUnitsQueryParam("?"), &forecast)
+	return
+}
+
+// StationQuery filters the stations returned by ListStations. Zero fields are
+// ignored.
+type StationQuery struct {
+	State []string // state or marine area codes, e.g. "IL"
+	ID    []string // station IDs, e.g. "KORD"
+	Limit int      // stations per page
+}
+
+// values returns the query parameters of q for the /stations endpoint.
+func (q StationQuery) values() url.Values {
+	params := url.Values{}
+	if len(q.State) > 0 {
+		params.Set("state", strings.ToUpper(strings.Join(q.State, ",")))
+	}
+	if len(q.ID) > 0 {
+		params.Set("id", strings.ToUpper(strings.Join(q.ID, ",")))
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return params
+}
+
+// ListStations returns the metadata of the observation stations matching q,
+// for example every station in a state. The pages of the response are
+// combined, see SetMaxPages.
+func ListStations(q StationQuery) (stations *StationsListResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	endpoint, err := withQuery(configFrom(ctx).endpointStations(), q.values())
+	if err != nil {
+		return nil, err
+	}
+	return decodePages[StationsListResponse](ctx, endpoint, 1)
+}
+
+// NearestStations returns the n observation stations for a given <lat,lon>
+// that are closest to it, nearest first, with their great-circle Distance in
+// kilometers. The station metadata included in the stations response is used;
+// if the response has none, each station is requested with Station.
+func NearestStations(lat string, lon string, n int) ([]StationResponse, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q: %w", lat, err)
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q: %w", lon, err)
+	}
+	stations, err := StationsContext(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	details := stations.Details
+	if len(details) == 0 {
+		for _, stationURL := range stations.Stations {
+			station, err := stationContext(ctx, StationID(stationURL))
+			if err != nil {
+				return nil, err
+			}
+			details = append(details, *station)
+		}
+	}
+
+	nearest := make([]StationResponse, 0, len(details))
+	for _, station := range details {
+		stationLat, stationLon, err := station.Coordinates()
+		if err != nil {
+			continue // no location so the distance is unknown
+		}
+		station.Distance = greatCircleDistance(latitude, longitude, stationLat, stationLon)
+		nearest = append(nearest, station)
+	}
+	sort.SliceStable(nearest, func(i, j int) bool {
+		return nearest[i].Distance < nearest[j].Distance
+	})
+	if n >= 0 && n < len(nearest) {
+		nearest = nearest[:n]
+	}
+	return nearest, nil
+}
+
+// StationsByOffice returns an array of observation station IDs (urls) for the
+// grid identified by office (WFO) and grid x,y without looking up a point.
+// For example, StationsByOffice("LOT", 74, 71). See PointsResponse.GridID.
+func StationsByOffice(wfo string, x int64, y int64) (stations *StationsResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	err = decode(ctx, configFrom(ctx).endpointGridpointStations(wfo, x, y), &stations)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ZoneForecast returns the text forecast for a public forecast zone identified
+// by ID, for example "ILZ014".
+func ZoneForecast(zoneID string) (forecast *ZoneForecastResponse, err error) {
+	return zoneForecast("forecast", zoneID)
+}
+
+// marineAreas are the zone ID prefixes of the coastal, offshore, and Great
+// Lakes marine areas, for example "GM" (Gulf of Mexico) in GMZ856.
+var marineAreas = map[string]bool{
+	"AM": true, "AN": true, "GM": true, "LC": true, "LE": true,
+	"LH": true, "LM": true, "LO": true, "LS": true, "PH": true,
+	"PK": true, "PM": true, "PS": true, "PZ": true, "SL": true,
+}
+
+// MarineForecast returns the text forecast for a marine zone identified by ID,
+// for example "GMZ856". An error is returned without calling the API if the ID
+// is not a marine zone.
+func MarineForecast(zoneID string) (forecast *ZoneForecastResponse, err error) {
+	id := strings.ToUpper(zoneID)
+	if len(id) != 6 || id[2] != 'Z' || !marineAreas[id[:2]] {
+		return nil, fmt.Errorf("%q is not a marine zone", zoneID)
+	}
+	return zoneForecast("marine", id)
+}
+
+func zoneForecast(zoneType string, zoneID string) (forecast *ZoneForecastResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	err = decode(ctx, configFrom(ctx).endpointZoneForecast(zoneType, zoneID), &forecast)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Observations returns the most recent page of observations for the station
+// identified by ID, for example "KORD". The pages of the response are
+// combined, see SetMaxPages and ObservationsResponse.NextPage.
+func Observations(stationID string) (observations *ObservationsResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return decodePages[ObservationsResponse](ctx, configFrom(ctx).endpointObservations(stationID), 1)
+}
+
+// LatestObservation returns the most recent observation for the station
+// identified by ID, for example "KORD".
+func LatestObservation(stationID string) (observation *Observation, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return latestObservation(ctx, stationID)
+}
+
+func latestObservation(ctx context.Context, stationID string) (observation *Observation, err error) {
+	err = decode(ctx, configFrom(ctx).endpointObservationLatest(stationID), &observation)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ErrObservationNotFound is returned by ObservationAt when the station has no
+// observation at the requested time.
+var ErrObservationNotFound = errors.New("observation not found")
+
+// ObservationAt returns the observation made at exactly t by the station
+// identified by ID, for example "KORD". Observations are usually made a few
+// minutes before the hour, see Observations for the times available.
+func ObservationAt(stationID string, t time.Time) (observation *Observation, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	timestamp := t.UTC().Format(time.RFC3339)
+	err = decode(ctx, configFrom(ctx).endpointObservationAt(stationID, timestamp), &observation)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s at %s", ErrObservationNotFound, stationID, timestamp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Cache of the station lists of points used by ObservationForPoint, keyed by
+// the full observation stations endpoint of the point.
+var (
+	stationsMu    sync.Mutex
+	stationsCache = map[string]*StationsResponse{}
+)
+
+// clearCaches forgets the cached points, station lists and hourly forecasts
+// when the endpoints change, see SetBaseURL and SetPathPrefix. It may be
+// called with configMu held, so it must not read the config.
+func clearCaches() {
+	pointsMu.Lock()
+	pointsCache = map[string]*PointsResponse{}
+	notFoundPoints = map[string]notFoundPoint{}
+	pointsMu.Unlock()
+
+	stationsMu.Lock()
+	stationsCache = map[string]*StationsResponse{}
+	stationsMu.Unlock()
+
+	hourlyMu.Lock()
+	hourlyCache = map[string]hourlyForecastEntry{}
+	hourlyMu.Unlock()
+}
+
+// ObservationForPoint returns the most recent observation of the station
+// identified by ID, for example "KORD", after checking that it is one of the
+// observation stations of the given <lat,lon>. An error is returned without
+// fetching the observation if it is not. The point and its stations are cached.
+func ObservationForPoint(lat string, lon string, stationID string) (observation *Observation, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	point, err := PointsContext(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	stationsMu.Lock()
+	stations := stationsCache[point.EndpointObservationStations]
+	stationsMu.Unlock()
+	if stations == nil {
+		err = decode(ctx, point.EndpointObservationStations, &stations)
+		if err != nil {
+			return nil, err
+		}
+		stationsMu.Lock()
+		stationsCache[point.EndpointObservationStations] = stations
+		stationsMu.Unlock()
+	}
+	for _, station := range stations.Stations {
+		if strings.EqualFold(StationID(station), stationID) {
+			return latestObservation(ctx, StationID(station))
+		}
+	}
+	return nil, fmt.Errorf("station %q is not an observation station for %s,%s", stationID, lat, lon)
+}
+
+// LatestMETAR returns the raw METAR of the most recent observation for the
+// station identified by ID, for example "KORD". See Observation.METAR.
+func LatestMETAR(stationID string) (metar string, err error) {
+	observation, err := LatestObservation(stationID)
+	if err != nil {
+		return "", err
+	}
+	return observation.METAR(), nil
+}
+
+// Forecast returns an array of forecast observations (14 periods and 2/day max).
+// Options such as WithFeatureFlags apply to the forecast request only.
+func Forecast(lat string, lon string, opts ...Option) (forecast *ForecastResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return ForecastContext(ctx, lat, lon, opts...)
+}
+
+// ForecastContext is like Forecast but uses the provided context for the point
+// lookup and the forecast request.
+func ForecastContext(ctx context.Context, lat string, lon string, opts ...Option) (forecast *ForecastResponse, err error) {
+	ctx, cfg := callConfig(ctx)
+	point, err := PointsContext(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	return dailyForecast(withOptions(ctx, opts), point, cfg.Units, nil)
+}
+
+// ForecastUnits is like Forecast but requests the forecast in the given units,
+// "us" or "si" ("" for the API default) or an alias accepted by SetUnits,
+// instead of the configured units. This allows forecasts in different units to
+// be fetched concurrently.
+func ForecastUnits(lat string, lon string, units string) (forecast *ForecastResponse, err error) {
+	if units, err = parseUnits(units); err != nil {
+		return nil, err
+	}
+	ctx, cancel := defaultContext()
+	defer cancel()
+	point, err := PointsContext(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	return dailyForecast(ctx, point, units, nil)
+}
+
+// ForecastWithParams is like Forecast but adds arbitrary query parameters to
+// the forecast request. The parameters are merged with the units parameter
+// added by the client; a "units" parameter in params takes precedence and
+// accepts the same values as SetUnits. ErrInvalidUnits is returned otherwise.
+func ForecastWithParams(lat string, lon string, params url.Values) (forecast *ForecastResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	units := configFrom(ctx).Units
+	if params.Has("units") {
+		if units, err = parseUnits(params.Get("units")); err != nil {
+			return nil, err
+		}
+		// the parsed units are added to the query by dailyForecast
+		others := url.Values{}
+		for key, values := range params {
+			if key != "units" {
+				others[key] = values
+			}
+		}
+		params = others
+	}
+	point, err := PointsContext(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	return dailyForecast(ctx, point, units, params)
+}
+
+// dailyForecast returns the forecast in units for an already resolved point.
+// Any params are added to the query of the request.
+func dailyForecast(ctx context.Context, point *PointsResponse, units string, params url.Values) (forecast *ForecastResponse, err error) {
+	endpoint, err := withQuery(withUnits(point.EndpointForecast, units), params)
+	if err != nil {
+		return nil, err
+	}
+	err = decode(ctx, endpoint, &forecast)
 	if err != nil {
 		return nil, err
 	}
 	forecast.Point = point
-	updateForecastPeriods(forecast.Periods)
+	updateForecastPeriods(forecast.Periods, units)
 	return
 }
 
+// FullForecast returns both the forecast and the hourly forecast for a given
+// <lat,lon>. The point is resolved once and both forecasts are then requested
+// concurrently, so they are guaranteed to be for the same grid.
+func FullForecast(lat string, lon string) (full *FullForecastResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return FullForecastContext(ctx, lat, lon)
+}
+
+// FullForecastContext is like FullForecast but uses the provided context for
+// the point lookup and the forecast requests.
+func FullForecastContext(ctx context.Context, lat string, lon string) (full *FullForecastResponse, err error) {
+	ctx, cfg := callConfig(ctx)
+	point, err := PointsContext(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+
+	full = &FullForecastResponse{Point: point}
+	var hourlyErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		full.Hourly, hourlyErr = hourlyForecast(ctx, point, cfg.Units)
+	}()
+	full.Forecast, err = dailyForecast(ctx, point, cfg.Units, nil)
+	<-done
+
+	if err != nil {
+		return nil, err
+	}
+	if hourlyErr != nil {
+		return nil, hourlyErr
+	}
+	return full, nil
+}
+
 // GridpointForecast returns an array of raw forecast data
 func GridpointForecast(lat string, long string) (forecast *GridpointForecastResponse, err error) {
-	point, err := Points(lat, long)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return GridpointForecastContext(ctx, lat, long)
+}
+
+// GridpointForecastContext is like GridpointForecast but uses the provided context for the point
+// lookup and the forecast request.
+func GridpointForecastContext(ctx context.Context, lat string, long string) (forecast *GridpointForecastResponse, err error) {
+	ctx, cfg := callConfig(ctx)
+	point, err := PointsContext(ctx, lat, long)
+	if err != nil {
+		return nil, err
+	}
+	return gridpointForecast(ctx, point, cfg.Units)
+}
+
+// GridpointForecastUnits is like GridpointForecast but requests the forecast in
+// the given units, "us" or "si" ("" for the API default) or an alias accepted
+// by SetUnits, instead of the configured units.
+func GridpointForecastUnits(lat string, long string, units string) (forecast *GridpointForecastResponse, err error) {
+	if units, err = parseUnits(units); err != nil {
+		return nil, err
+	}
+	ctx, cancel := defaultContext()
+	defer cancel()
+	point, err := PointsContext(ctx, lat, long)
 	if err != nil {
 		return nil, err
 	}
-	err = decode(point.EndpointForecastGridData+config.getUnitsQueryParam("?"), &forecast)
+	return gridpointForecast(ctx, point, units)
+}
+
+// gridpointForecast returns the gridpoint forecast in units for an already
+// resolved point.
+func gridpointForecast(ctx context.Context, point *PointsResponse, units string) (forecast *GridpointForecastResponse, err error) {
+	err = decode(ctx, withUnits(point.EndpointForecastGridData, units), &forecast)
 	if err != nil {
 		return nil, err
 	}
@@ -78,40 +773,159 @@ func GridpointForecast(lat string, long string) (forecast *GridpointForecastResp
 	return forecast, nil
 }
 
-// HourlyForecast returns an array of raw hourly forecast data
-func HourlyForecast(lat string, long string) (forecast *HourlyForecastResponse, err error) {
-	point, err := Points(lat, long)
+// HourlyForecast returns an array of raw hourly forecast data.
+// Options such as WithFeatureFlags apply to the forecast request only.
+func HourlyForecast(lat string, long string, opts ...Option) (forecast *HourlyForecastResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return HourlyForecastContext(ctx, lat, long, opts...)
+}
+
+// HourlyForecastContext is like HourlyForecast but uses the provided context for the point
+// lookup and the forecast request.
+func HourlyForecastContext(ctx context.Context, lat string, long string, opts ...Option) (forecast *HourlyForecastResponse, err error) {
+	ctx, cfg := callConfig(ctx)
+	point, err := PointsContext(ctx, lat, long)
 	if err != nil {
 		return nil, err
 	}
-	err = decode(point.EndpointForecastHourly+config.getUnitsQueryParam("?"), &forecast)
+	return hourlyForecast(withOptions(ctx, opts), point, cfg.Units)
+}
+
+// HourlyForecastUnits is like HourlyForecast but requests the forecast in the
+// given units, "us" or "si" ("" for the API default) or an alias accepted by
+// SetUnits, instead of the configured units.
+func HourlyForecastUnits(lat string, long string, units string) (forecast *HourlyForecastResponse, err error) {
+	if units, err = parseUnits(units); err != nil {
+		return nil, err
+	}
+	ctx, cancel := defaultContext()
+	defer cancel()
+	point, err := PointsContext(ctx, lat, long)
+	if err != nil {
+		return nil, err
+	}
+	return hourlyForecast(ctx, point, units)
+}
+
+// hourlyForecast returns the hourly forecast in units for an already resolved
+// point.
+func hourlyForecast(ctx context.Context, point *PointsResponse, units string) (forecast *HourlyForecastResponse, err error) {
+	if point == nil {
+		return nil, errors.New("the forecast has no point")
+	}
+	endpoint := withUnits(point.EndpointForecastHourly, units)
+	key := endpoint + " " + strings.Join(featureFlags(ctx), ", ")
+	ttl := configFrom(ctx).ForecastCacheTTL
+	if ttl > 0 {
+		if cached := cachedHourlyForecast(key); cached != nil {
+			return cached, nil
+		}
+	}
+	err = decode(ctx, endpoint, &forecast)
 	if err != nil {
 		return nil, err
 	}
 	forecast.Point = point
-	updateForecastPeriods(forecast.Periods)
+	recordGenerator(forecast.ForecastGenerator)
+	updateForecastPeriods(forecast.Periods, units)
+	if ttl > 0 {
+		cacheHourlyForecast(key, forecast, ttl)
+	}
 	return forecast, nil
 }
 
+// hourlyForecastEntry is a cached hourly forecast, see SetForecastCacheTTL.
+type hourlyForecastEntry struct {
+	forecast *HourlyForecastResponse
+	expires  time.Time
+}
+
+// Cache of hourly forecasts keyed by endpoint and feature flags.
+var (
+	hourlyMu    sync.Mutex
+	hourlyCache = map[string]hourlyForecastEntry{}
+)
+
+// cachedHourlyForecast returns a copy of the cached forecast for key, or nil if
+// there is none or it has expired.
+func cachedHourlyForecast(key string) *HourlyForecastResponse {
+	hourlyMu.Lock()
+	defer hourlyMu.Unlock()
+	entry, ok := hourlyCache[key]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(hourlyCache, key)
+		return nil
+	}
+	forecast := *entry.forecast
+	forecast.Periods = append([]ForecastResponsePeriodHourly(nil), forecast.Periods...)
+	return &forecast
+}
+
+// cacheHourlyForecast caches a copy of forecast for ttl or until it is no
+// longer valid, whichever comes first.
+func cacheHourlyForecast(key string, forecast *HourlyForecastResponse, ttl time.Duration) {
+	validUntil, err := forecast.ValidUntil()
+	if err != nil {
+		return
+	}
+	expires := time.Now().Add(ttl)
+	if validUntil.Before(expires) {
+		expires = validUntil
+	}
+	cached := *forecast
+	cached.Periods = append([]ForecastResponsePeriodHourly(nil), forecast.Periods...)
+	hourlyMu.Lock()
+	defer hourlyMu.Unlock()
+	hourlyCache[key] = hourlyForecastEntry{forecast: &cached, expires: expires}
+}
+
+// withQuery sets params on the query of endpoint, keeping any other query
+// parameters that are already present.
+func withQuery(endpoint string, params url.Values) (string, error) {
+	if len(params) == 0 {
+		return endpoint, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
 // Using the quantitative value feature flags to enable QV responses
 // causes the noaa api to ignore the requested unit types. This also
 // populates fields that were previously populated for backward
 // compatibility. This is necessary because quantitative values replace
 // deprecated fields with a nested object. See: QuantitativeValue.
 // These are nice to have but may be deprecated in the future.
-func updateForecastPeriods(periods []ForecastResponsePeriod) {
+// When QV are disabled, globally or for a call, the legacy values are
+// decoded directly and periods without QV data are left unchanged.
+func updateForecastPeriods(periods []ForecastResponsePeriod, units string) {
 	for i, period := range periods {
-		updateTemperature(&period)
-		updateWindSpeed(&period)
+		updateTemperature(&period, units)
+		updateWindSpeed(&period, units)
+		updateWindGust(&period, units)
 		periods[i] = period
 	}
 }
 
 // See: updateForecastPeriods
-func updateTemperature(period *ForecastResponsePeriod) {
+func updateTemperature(period *ForecastResponsePeriod, units string) {
+	if period.QuantitativeTemperature.UnitCode == "" {
+		return // no QV data so keep the legacy value
+	}
 	wmoUnitCode := period.QuantitativeTemperature.UnitCode
 	period.Temperature = period.QuantitativeTemperature.Value
-	if config.Units == "si" {
+	if units == "si" {
 		period.TemperatureUnit = "C"
 		if wmoUnitCode != "wmoUnit:degC" {
 			// assume its degrees F so convert it accordingly
@@ -131,15 +945,33 @@ const (
 )
 
 // See: updateForecastPeriods
-func updateWindSpeed(period *ForecastResponsePeriod) {
-	wmoUnitCode := period.QuantitativeWindSpeed.UnitCode
-	min := period.QuantitativeWindSpeed.MinValue
-	max := period.QuantitativeWindSpeed.MaxValue
-	value := period.QuantitativeWindSpeed.Value
-	units := ""
-
-	if config.Units == "si" {
-		units = "km/h"
+func updateWindSpeed(period *ForecastResponsePeriod, units string) {
+	if period.QuantitativeWindSpeed.UnitCode == "" {
+		return // no QV data so keep the legacy value
+	}
+	period.WindSpeed = formatWindSpeed(period.QuantitativeWindSpeed, units)
+}
+
+// See: updateForecastPeriods
+func updateWindGust(period *ForecastResponsePeriod, units string) {
+	if !period.QuantitativeWindGust.HasValue() {
+		period.WindGust = "" // usually null when no gusts are forecast
+		return
+	}
+	period.WindGust = formatWindSpeed(period.QuantitativeWindGust, units)
+}
+
+// formatWindSpeed formats a QV wind speed in units like the legacy API, e.g.
+// "10 mph" or "5 to 10 mph".
+func formatWindSpeed(speed QuantitativeValue, units string) string {
+	wmoUnitCode := speed.UnitCode
+	min := speed.MinValue
+	max := speed.MaxValue
+	value := speed.Value
+	symbol := ""
+
+	if units == "si" {
+		symbol = "km/h"
 		if wmoUnitCode != "wmoUnit:km_h-1" {
 			// assume its mph so convert it accordingly
 			min *= KilometersPerMile
@@ -147,7 +979,7 @@ func updateWindSpeed(period *ForecastResponsePeriod) {
 			value *= KilometersPerMile
 		}
 	} else {
-		units = "mph"
+		symbol = "mph"
 		if wmoUnitCode == "wmoUnit:km_h-1" {
 			// assume its kmh so convert it accordingly
 			min *= MilesPerKilometer
@@ -158,8 +990,7 @@ func updateWindSpeed(period *ForecastResponsePeriod) {
 
 	// replicates legacy api behavior but using quantitative values
 	if min == 0.0 && max == 0.0 {
-		period.WindSpeed = fmt.Sprintf("%.0f %s", value, units)
-	} else {
-		period.WindSpeed = fmt.Sprintf("%.0f to %.0f %s", min, max, units)
+		return fmt.Sprintf("%.0f %s", value, symbol)
 	}
+	return fmt.Sprintf("%.0f to %.0f %s", min, max, symbol)
 }
@@ -1,21 +1,173 @@
 //go:build !examples
 // +build !examples
 
-// Unit tests can be run with `go test -v` and require access to the API. Many of
-// these tests are actually integration tests that call the weather.gov API and
-// parse responses accordingly to confirm expected responses are returned.
+// Unit tests can be run with `go test -v` and run offline against the recorded
+// responses found in the testdata directory.
 //
-// Thus, in the future if weather.gov changes the endpoints or responses, these
-// tests should alert users of this wrapper SDK accordingly.
+// The tests that call useAPI are also integration tests that call the
+// weather.gov API when run with `NOAA_LIVE=1 go test -v` and parse responses
+// accordingly to confirm expected responses are returned. Thus, in the future
+// if weather.gov changes the endpoints or responses, these tests should alert
+// users of this wrapper SDK accordingly.
 package noaa_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/icodealot/noaa"
+	"go.uber.org/goleak"
 )
 
+// fixtures is an http.RoundTripper that serves recorded API responses from the
+// testdata directory keyed by URL path. Unknown paths return a 404 just like
+// the weather.gov API does for points outside of its coverage.
+type fixtures map[string]string
+
+// apiFixtures maps weather.gov endpoints to the files in testdata.
+var apiFixtures = fixtures{
+	"/points/41.837,-87.685":                           "points_chicago.json",
+	"/points/64.828421,-147.7390417":                   "points_alaska.json",
+	"/offices/LOT":                                     "office_lot.json",
+	"/gridpoints/LOT/74,71/forecast":                   "forecast_chicago.json",
+	"/gridpoints/LOT/74,71/forecast/hourly":            "forecast_hourly_chicago.json",
+	"/stations/KORD/observations":                      "observations_kord.json",
+	"/stations/KORD/observations/latest":               "observation_latest_kord.json",
+	"/stations/KORD/observations/2023-05-21T14:51:00Z": "observation_latest_kord.json",
+	"/alerts":                                        "alerts_il.json",
+	"/gridpoints/LOT/74,71/stations":                 "stations_chicago.json",
+	"/stations":                                      "stations_il.json",
+	"/aviation/cwsus/ZAU":                            "cwsu_zau.json",
+	"/aviation/cwsus/ZAU/cwas":                       "cwas_zau.json",
+	"/aviation/sigmets":                              "sigmets_kkci.json",
+	"/products/types/AFD/locations/LOT":              "products_afd_lot.json",
+	"/products/5c0a2c46-1f35-4f3a-a8a5-0e6a1d2b7c11": "product_afd_lot.json",
+}
+
+func (f fixtures) RoundTrip(req *http.Request) (*http.Response, error) {
+	name, ok := f[req.URL.Path]
+	if !ok {
+		return fixtureResponse(req, http.StatusNotFound, []byte(`{"status": 404}`)), nil
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		return nil, err
+	}
+	return fixtureResponse(req, http.StatusOK, data), nil
+}
+
+func fixtureResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/ld+json"}},
+		Body:       io.NopCloser(strings.NewReader(string(body))),
+		Request:    req,
+	}
+}
+
+// geoFixtures maps weather.gov endpoints to GeoJSON responses in testdata.
+var geoFixtures = fixtures{
+	"/points/39.7456,-97.0892":    "points_topeka.geojson",
+	"/stations/KORD/observations": "observations_kord.geojson",
+}
+
+// blockingTransport is an http.RoundTripper that never responds and instead
+// waits for the request's context to be done.
+type blockingTransport struct{}
+
+func (blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+// countingClient is a noaa.Doer that counts the requests made through it and
+// delays each response so that concurrent requests overlap.
+type countingClient struct {
+	requests  int32
+	transport http.RoundTripper
+}
+
+func (c *countingClient) Do(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&c.requests, 1)
+	time.Sleep(50 * time.Millisecond)
+	return c.transport.RoundTrip(req)
+}
+
+// doerFunc adapts a function to a noaa.Doer.
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// useFixtures points the client at the recorded responses for the duration of
+// the test and restores the default config and state afterwards.
+func useFixtures(t *testing.T) {
+	t.Helper()
+	noaa.SetClient(&http.Client{Transport: apiFixtures})
+	t.Cleanup(func() {
+		noaa.SetConfig(noaa.GetDefaultConfig())
+		noaa.ResetGenerators()
+	})
+}
+
+// liveAPI is set with NOAA_LIVE=1 to run the tests that call useAPI against
+// the weather.gov API.
+var liveAPI = os.Getenv("NOAA_LIVE") == "1"
+
+// useAPI is like useFixtures but uses the weather.gov API instead of the
+// recorded responses if liveAPI is set. The transport used is returned.
+func useAPI(t *testing.T) http.RoundTripper {
+	t.Helper()
+	useFixtures(t)
+	if !liveAPI {
+		return apiFixtures
+	}
+	noaa.SetClient(http.DefaultClient)
+	return http.DefaultTransport
+}
+
+func TestUpdateConfig(t *testing.T) {
+	useFixtures(t)
+	if err := noaa.SetUserAgent("(example.com, contact@example.com)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := noaa.UpdateConfig(noaa.Config{Units: "si", Retries: 2}); err != nil {
+		t.Fatalf("noaa.UpdateConfig() returned an error: %v", err)
+	}
+	config := noaa.GetConfig()
+	if config.Units != "si" || config.Retries != 2 {
+		t.Errorf("expected the given fields to be updated, got %+v", config)
+	}
+	if config.UserAgent != "(example.com, contact@example.com)" || config.BaseURL != noaa.API {
+		t.Errorf("expected the other fields to be unchanged, got %+v", config)
+	}
+	if err := noaa.UpdateConfig(noaa.Config{Units: "metric"}); err == nil || noaa.GetConfig().Units != "si" {
+		t.Error("noaa.UpdateConfig() should reject invalid units and leave the config unchanged")
+	}
+}
+
 func TestBlank(t *testing.T) {
+	useAPI(t)
 	point, err := noaa.Points("", "")
 	if point == nil && err != nil {
 		return
@@ -24,6 +176,7 @@ func TestBlank(t *testing.T) {
 }
 
 func TestBlankLat(t *testing.T) {
+	useAPI(t)
 	point, err := noaa.Points("", "-147.7390417")
 	if point == nil && err != nil {
 		return
@@ -32,6 +185,7 @@ func TestBlankLat(t *testing.T) {
 }
 
 func TestBlankLon(t *testing.T) {
+	useAPI(t)
 	point, err := noaa.Points("64.828421", "")
 	if point == nil && err != nil {
 		return
@@ -39,7 +193,132 @@ func TestBlankLon(t *testing.T) {
 	t.Error("noaa.Points() should return a 404 error for a blank lon.")
 }
 
+func TestPing(t *testing.T) {
+	useFixtures(t)
+	noaa.SetClient(&http.Client{Transport: fixtures{"/": "status.json"}})
+	if err := noaa.Ping(context.Background()); err != nil {
+		t.Errorf("noaa.Ping() should succeed when the API root responds: %v", err)
+	}
+	noaa.SetClient(&http.Client{Transport: fixtures{}})
+	if err := noaa.Ping(context.Background()); err == nil {
+		t.Error("noaa.Ping() should return an error when the API root does not respond with a 200")
+	}
+}
+
+func TestClientNotReplaced(t *testing.T) {
+	useFixtures(t)
+	client := noaa.NewClientWithTransport(apiFixtures, 0)
+	noaa.SetClient(client)
+	if _, err := noaa.Office("LOT"); err != nil {
+		t.Fatal(err)
+	}
+	if noaa.GetConfig().Client != client {
+		t.Error("the client set with noaa.SetClient() should not be replaced")
+	}
+}
+
+func TestEndpointEscaping(t *testing.T) {
+	useFixtures(t)
+	var paths []string
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.EscapedPath())
+		return apiFixtures.RoundTrip(req)
+	}))
+	noaa.Office("LOT/")
+	noaa.Points("41.837 ", "-87.685")
+	noaa.LatestObservation("../KORD")
+	want := []string{"/offices/LOT%2F", "/points/41.837%20,-87.685", "/stations/..%2FKORD/observations/latest"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected the IDs to be escaped, got requests for %q", paths)
+	}
+}
+
+func TestWithFeatureFlags(t *testing.T) {
+	useFixtures(t)
+	var flags []string
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		flags = append(flags, req.Header.Get("feature-flags"))
+		return apiFixtures.RoundTrip(req)
+	}))
+	if _, err := noaa.Forecast("41.837", "-87.685", noaa.WithFeatureFlags()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noaa.HourlyForecast("41.837", "-87.685", noaa.WithFeatureFlags("forecast_temperature_qv")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noaa.Forecast("41.837", "-87.685"); err != nil {
+		t.Fatal(err)
+	}
+	// the point may be looked up before the first forecast, so check the last 3
+	got := flags[len(flags)-3:]
+	want := []string{"", "forecast_temperature_qv", "forecast_temperature_qv, forecast_wind_speed_qv"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected feature-flags %q, got %q", want, got)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	useFixtures(t)
+	var mu sync.Mutex
+	requested := map[string]bool{}
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requested[req.URL.String()] = true
+		mu.Unlock()
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/v2") // serve the unversioned fixtures
+		return apiFixtures.RoundTrip(req)
+	}))
+	noaa.SetUnits("si")
+	noaa.SetPathPrefix("/v2")
+
+	endpoints, err := noaa.Endpoints("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.Endpoints() should return the endpoints of the fixture: %v", err)
+	}
+	if _, err := noaa.Forecast("41.837", "-87.685"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noaa.HourlyForecast("41.837", "-87.685"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"points", "forecast", "forecastHourly"} {
+		if !requested[endpoints[name]] {
+			t.Errorf("expected %s endpoint %q to be requested, got %v", name, endpoints[name], requested)
+		}
+	}
+	if want := "https://api.weather.gov/gridpoints/LOT/74,71?units=si"; endpoints["forecastGridData"] != want {
+		t.Errorf("expected %q, got %q", want, endpoints["forecastGridData"])
+	}
+}
+
+func TestForecastWithParams(t *testing.T) {
+	useFixtures(t)
+	var query url.Values
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(req.URL.Path, "/gridpoints/") {
+			query = req.URL.Query()
+		}
+		return apiFixtures.RoundTrip(req)
+	}))
+	noaa.SetUnits("us")
+	params := url.Values{"units": {"metric"}, "extra": {"1"}}
+	forecast, err := noaa.ForecastWithParams("41.837", "-87.685", params)
+	if err != nil {
+		t.Fatalf("noaa.ForecastWithParams() should accept the metric alias: %v", err)
+	}
+	if query.Get("units") != "si" || query.Get("extra") != "1" || forecast.Periods[0].TemperatureUnit != "C" {
+		t.Errorf("expected units=si and the extra parameter, got %q and °%s", query.Encode(), forecast.Periods[0].TemperatureUnit)
+	}
+	if params.Get("units") != "metric" {
+		t.Errorf("the params of the caller should not be changed, got %v", params)
+	}
+	if _, err := noaa.ForecastWithParams("41.837", "-87.685", url.Values{"units": {"kelvin"}}); !errors.Is(err, noaa.ErrInvalidUnits) {
+		t.Errorf("expected ErrInvalidUnits, got %v", err)
+	}
+}
+
 func TestZero(t *testing.T) {
+	useAPI(t)
 	point, err := noaa.Points("0", "0")
 	if point == nil && err != nil {
 		return
@@ -47,7 +326,62 @@ func TestZero(t *testing.T) {
 	t.Error("noaa.Points() should return a 404 error for a zero lat, lon.")
 }
 
+func TestRelativeLocation(t *testing.T) {
+	useFixtures(t)
+	point, err := noaa.Points("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.Points() should return the Chicago point: %v", err)
+	}
+	location := point.RelativeLocation
+	if location.City != "Chicago" || location.State != "IL" {
+		t.Errorf("expected Chicago, IL, got %s, %s", location.City, location.State)
+	}
+	if location.Distance.Value != 185.1 || location.Distance.UnitCode != "wmoUnit:m" || location.Bearing.Value != 22 {
+		t.Errorf("expected 185.1 m at 22°, got %s at %s", location.Distance, location.Bearing)
+	}
+}
+
+func TestPointsZones(t *testing.T) {
+	useFixtures(t)
+	point, err := noaa.Points("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.Points() should return the Chicago point: %v", err)
+	}
+	zones := []struct{ got, want string }{
+		{point.EndpointForecastZone, "https://api.weather.gov/zones/forecast/ILZ014"},
+		{point.EndpointCounty, "https://api.weather.gov/zones/county/ILC031"},
+		{point.EndpointFireWeatherZone, "https://api.weather.gov/zones/fire/ILZ014"},
+	}
+	for _, zone := range zones {
+		if zone.got != zone.want {
+			t.Errorf("expected zone %s, got %q", zone.want, zone.got)
+		}
+	}
+}
+
+func TestStrictCoordinates(t *testing.T) {
+	useFixtures(t)
+	var requests int32
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return apiFixtures.RoundTrip(req)
+	}))
+	noaa.SetStrictCoordinates(true)
+	for _, point := range [][2]string{{"", ""}, {"", "-147.7390417"}, {"64.828421", " "}, {"0", "0"}, {"0.0", "-0"}} {
+		if _, err := noaa.Points(point[0], point[1]); !errors.Is(err, noaa.ErrInvalidCoordinates) {
+			t.Errorf("noaa.Points(%q, %q) should return ErrInvalidCoordinates, got %v", point[0], point[1], err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("expected no requests for invalid coordinates, got %d", n)
+	}
+	if _, err := noaa.Points("41.837", "-87.685"); err != nil {
+		t.Errorf("noaa.Points() should accept valid coordinates: %v", err)
+	}
+}
+
 func TestInternational(t *testing.T) {
+	useAPI(t)
 	point, err := noaa.Points("48.85660", "2.3522") // Paris, France
 	if point == nil && err != nil {
 		return
@@ -55,7 +389,138 @@ func TestInternational(t *testing.T) {
 	t.Error("noaa.Points() should return a 404 error for lat, lon outside the U.S. territories.")
 }
 
+func TestNegativeCache(t *testing.T) {
+	useFixtures(t)
+	noaa.SetNegativeCacheTTL(time.Minute)
+	if _, err := noaa.Points("1", "1"); !noaa.IsOutsideUS(err) {
+		t.Fatalf("noaa.Points() should return a 404 error, got %v", err)
+	}
+	// the point now exists but the cached 404 should be returned without a request
+	noaa.SetClient(&http.Client{Transport: fixtures{"/points/1,1": "points_chicago.json"}})
+	if _, err := noaa.Points("1", "1"); !noaa.IsOutsideUS(err) {
+		t.Errorf("noaa.Points() should return the cached 404 error, got %v", err)
+	}
+}
+
+func TestConcurrentPoints(t *testing.T) {
+	useFixtures(t)
+	client := &countingClient{transport: fixtures{"/points/41.8,-87.6": "points_chicago.json"}}
+	noaa.SetClient(client)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if point, err := noaa.Points("41.8", "-87.6"); err != nil || point.CWA != "LOT" {
+				t.Errorf("noaa.Points() should return the Chicago point, got %+v, %v", point, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&client.requests); n != 1 {
+		t.Errorf("expected concurrent lookups to share 1 request, got %d", n)
+	}
+}
+
+func TestPointsSharedCancel(t *testing.T) {
+	useFixtures(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	noaa.SetClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		once.Do(func() { close(started) })
+		select {
+		case <-release:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", "points_chicago.json"))
+		return fixtureResponse(req, http.StatusOK, data), err
+	})})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := noaa.PointsContext(ctx, "41.9", "-87.7") // not cached
+		first <- err
+	}()
+	select {
+	case <-started:
+	case err := <-first:
+		t.Fatalf("expected the request to be shared, got %v", err)
+	}
+	second := make(chan error)
+	go func() {
+		_, err := noaa.Points("41.9", "-87.7")
+		second <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // let the second caller share the request
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled caller to return context.Canceled, got %v", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("the other caller should not be canceled: %v", err)
+	}
+}
+
+func TestPointsCanceledByAllCallers(t *testing.T) {
+	useFixtures(t)
+	var requests int32
+	started, released := make(chan struct{}, 2), make(chan struct{}, 2)
+	noaa.SetClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		started <- struct{}{}
+		<-req.Context().Done() // hung until the request is canceled
+		released <- struct{}{}
+		return nil, req.Context().Err()
+	})})
+
+	var callers []context.CancelFunc
+	errs := make(chan error)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		callers = append(callers, cancel)
+		go func() {
+			_, err := noaa.PointsContext(ctx, "41.95", "-87.75") // not cached
+			errs <- err
+		}()
+	}
+	<-started
+	time.Sleep(10 * time.Millisecond) // let the second caller share the request
+
+	callers[0]()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled caller to return context.Canceled, got %v", err)
+	}
+	select {
+	case <-released:
+		t.Fatal("the request should continue while a caller is waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+	callers[1]()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the canceled caller to return context.Canceled, got %v", err)
+	}
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("the request should be canceled once no callers are left")
+	}
+
+	// the next lookup starts a new request instead of joining the canceled one
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	noaa.PointsContext(ctx, "41.95", "-87.75")
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected a new request, got %d requests", n)
+	}
+}
+
 func TestAlaska(t *testing.T) {
+	useAPI(t)
 	point, err := noaa.Points("64.828421", "-147.7390417")
 	if point != nil && err == nil {
 		return
@@ -63,12 +528,48 @@ func TestAlaska(t *testing.T) {
 	t.Error("noaa.Points() should return valid points for parts of Alaska.")
 }
 
+// unitsRequested points the client at the API, see useAPI, and returns a
+// function that reports the units query parameter of the last gridpoint
+// (forecast) request. The fixtures respond in the requested units.
+func unitsRequested(t *testing.T) func() string {
+	transport := useAPI(t)
+	var mu sync.Mutex
+	var units string
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := transport.RoundTrip(req)
+		if err != nil || !strings.HasPrefix(req.URL.Path, "/gridpoints/") {
+			return res, err
+		}
+		mu.Lock()
+		units = req.URL.Query().Get("units")
+		mu.Unlock()
+		if units == "" || liveAPI {
+			return res, nil
+		}
+		// respond in the requested units like the API does
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = []byte(strings.Replace(string(body), `"units": "us"`, fmt.Sprintf("%q: %q", "units", units), 1))
+		return fixtureResponse(req, res.StatusCode, body), nil
+	}))
+	return func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return units
+	}
+}
+
 func TestMetricUnits(t *testing.T) {
+	units := unitsRequested(t)
 	noaa.SetUnits("si")
 	forecast, err := noaa.Forecast("41.837", "-87.685")
 	if err != nil || forecast == nil {
-		t.Error("noaa.Forecast() should return valid data for Chicago.")
-		return
+		t.Fatalf("noaa.Forecast() should return valid data for Chicago: %v", err)
+	}
+	if units() != "si" || forecast.Periods[0].TemperatureUnit != "C" {
+		t.Errorf("noaa.Forecast() should request Chicago in metric, got units=%q and °%s", units(), forecast.Periods[0].TemperatureUnit)
 	}
 	if forecast.Units != "si" {
 		t.Error("noaa.Forecast() should return valid data for Chicago in metric.")
@@ -76,17 +577,67 @@ func TestMetricUnits(t *testing.T) {
 }
 
 func TestUSUnits(t *testing.T) {
+	units := unitsRequested(t)
 	noaa.SetUnits("us")
 	forecast, err := noaa.Forecast("41.837", "-87.685")
-	if err != nil {
-		t.Error("noaa.Forecast() should return valid data for Chicago.")
+	if err != nil || forecast == nil {
+		t.Fatalf("noaa.Forecast() should return valid data for Chicago: %v", err)
+	}
+	if units() != "us" || forecast.Periods[0].TemperatureUnit != "F" {
+		t.Errorf("noaa.Forecast() should request Chicago in standard units, got units=%q and °%s", units(), forecast.Periods[0].TemperatureUnit)
 	}
 	if forecast.Units != "us" {
 		t.Error("noaa.Forecast() should return valid data for Chicago in standard units.")
 	}
 }
 
+func TestUnitsVariants(t *testing.T) {
+	units := unitsRequested(t)
+	noaa.SetUnits("us")
+	forecast, err := noaa.ForecastUnits("41.837", "-87.685", "si")
+	if err != nil {
+		t.Fatalf("noaa.ForecastUnits() should return the fixture: %v", err)
+	}
+	if units() != "si" || forecast.Periods[0].TemperatureUnit != "C" {
+		t.Errorf("noaa.ForecastUnits() should request metric, got units=%q and °%s", units(), forecast.Periods[0].TemperatureUnit)
+	}
+	if _, err := noaa.HourlyForecastUnits("41.837", "-87.685", ""); err != nil || units() != "" {
+		t.Errorf("noaa.HourlyForecastUnits() should request the API default, got units=%q, %v", units(), err)
+	}
+	for _, alias := range []struct{ units, want string }{{"metric", "si"}, {"Imperial", "us"}} {
+		if _, err := noaa.ForecastUnits("41.837", "-87.685", alias.units); err != nil || units() != alias.want {
+			t.Errorf("noaa.ForecastUnits(%q) should request units=%s, got units=%q, %v", alias.units, alias.want, units(), err)
+		}
+		if _, err := noaa.HourlyForecastUnits("41.837", "-87.685", alias.units); err != nil || units() != alias.want {
+			t.Errorf("noaa.HourlyForecastUnits(%q) should request units=%s, got units=%q, %v", alias.units, alias.want, units(), err)
+		}
+	}
+	if _, err := noaa.ForecastUnits("41.837", "-87.685", "kelvin"); !errors.Is(err, noaa.ErrInvalidUnits) {
+		t.Errorf("expected ErrInvalidUnits, got %v", err)
+	}
+	if config := noaa.GetConfig(); config.Units != "us" {
+		t.Errorf("the per-call units should not change the config, got %q", config.Units)
+	}
+}
+
+func TestSetUnits(t *testing.T) {
+	useFixtures(t)
+	tests := []struct{ units, want string }{
+		{"si", "si"}, {"US", "us"}, {"metric", "si"}, {"Imperial", "us"}, {"", ""},
+	}
+	for _, tt := range tests {
+		if err := noaa.SetUnits(tt.units); err != nil || noaa.GetConfig().Units != tt.want {
+			t.Errorf("%q: expected %q, got %q, %v", tt.units, tt.want, noaa.GetConfig().Units, err)
+		}
+	}
+	noaa.SetUnits("si")
+	if err := noaa.SetUnits("metirc"); !errors.Is(err, noaa.ErrInvalidUnits) || noaa.GetConfig().Units != "si" {
+		t.Errorf("expected ErrInvalidUnits and unchanged units, got %q, %v", noaa.GetConfig().Units, err)
+	}
+}
+
 func TestChicagoOffice(t *testing.T) {
+	useAPI(t)
 	office, err := noaa.Office("LOT")
 	if office != nil && err == nil {
 		if office.Name == "Chicago, IL" {
@@ -96,12 +647,1763 @@ func TestChicagoOffice(t *testing.T) {
 	t.Error("noaa.Office(\"LOT\") should return valid office information.")
 }
 
+func TestPathPrefix(t *testing.T) {
+	useFixtures(t)
+	noaa.SetClient(&http.Client{Transport: fixtures{"/v2/offices/LOT": "office_lot.json"}})
+	if err := noaa.SetPathPrefix("/v2/"); err == nil {
+		t.Error("noaa.SetPathPrefix() should reject a trailing slash")
+	}
+	if err := noaa.SetPathPrefix("/v2"); err != nil {
+		t.Fatal(err)
+	}
+	if office, err := noaa.Office("LOT"); err != nil || office.Name != "Chicago, IL" {
+		t.Errorf("noaa.Office() should request the prefixed endpoint, got %+v, %v", office, err)
+	}
+}
+
+func TestChicagoOfficeForPoint(t *testing.T) {
+	useFixtures(t)
+	office, err := noaa.OfficeForPoint("41.837", "-87.685")
+	if err != nil || office.Name != "Chicago, IL" {
+		t.Errorf("noaa.OfficeForPoint() should return the Chicago office, got %+v, %v", office, err)
+	}
+}
+
 func TestChicagoHourly(t *testing.T) {
+	useAPI(t)
 	hourly, err := noaa.HourlyForecast("41.837", "-87.685")
 	if err != nil {
 		t.Error("noaa.HourlyForecast() should return valid data for Chicago.")
+		return
 	}
 	if len(hourly.Periods) == 0 {
 		t.Error("expected at least one period")
 	}
 }
+
+func TestLegacyForecastDecode(t *testing.T) {
+	data, err := os.ReadFile("testdata/forecast_legacy.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forecast noaa.ForecastResponse
+	if err := json.Unmarshal(data, &forecast); err != nil {
+		t.Fatalf("decoding a non-QV forecast should not fail: %v", err)
+	}
+	if len(forecast.Periods) != 2 {
+		t.Fatalf("expected 2 periods, got %d", len(forecast.Periods))
+	}
+	period := forecast.Periods[0]
+	if period.Temperature != 76 || period.TemperatureUnit != "F" {
+		t.Errorf("expected legacy temperature 76F, got %.0f%s", period.Temperature, period.TemperatureUnit)
+	}
+	if period.WindSpeed != "5 to 10 mph" {
+		t.Errorf("expected legacy wind speed \"5 to 10 mph\", got %q", period.WindSpeed)
+	}
+}
+
+func TestBareNumberDecode(t *testing.T) {
+	for _, name := range []string{"forecast_chicago.json", "forecast_bare_numbers.json"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var forecast noaa.ForecastResponse
+		if err := json.Unmarshal(data, &forecast); err != nil {
+			t.Fatalf("decoding %s should not fail: %v", name, err)
+		}
+		if forecast.Elevation.Value != 180.1392 {
+			t.Errorf("%s: expected elevation 180.1392, got %v", name, forecast.Elevation.Value)
+		}
+		period := forecast.Periods[0]
+		if !period.QuantitativeDewpoint.HasValue() || period.QuantitativeDewpoint.Value != 10 {
+			t.Errorf("%s: expected dewpoint 10, got %+v", name, period.QuantitativeDewpoint)
+		}
+		if period.QuantitativeTemperature.Value != 24.444 {
+			t.Errorf("%s: expected temperature 24.444, got %+v", name, period.QuantitativeTemperature)
+		}
+	}
+
+	var q noaa.QuantitativeValue
+	if err := json.Unmarshal([]byte(`"not a number"`), &q); err == nil {
+		t.Error("decoding a non-numeric string as a quantitative value should fail")
+	}
+}
+
+func TestQuantitativeValueHasValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value noaa.QuantitativeValue
+		want  bool
+	}{
+		{"zero", noaa.QuantitativeValue{UnitCode: "wmoUnit:km_h-1"}, false},
+		{"literal", noaa.QuantitativeValue{Value: 5, UnitCode: "wmoUnit:km_h-1"}, true},
+		{"range", noaa.QuantitativeValue{MinValue: 5, MaxValue: 10}, true},
+		{"constructor", noaa.NewQuantitativeValue(0, "wmoUnit:degC"), true},
+	}
+	for _, tt := range tests {
+		if got := tt.value.HasValue(); got != tt.want {
+			t.Errorf("%s: expected HasValue() %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// decoding null into a reused value discards the previous value
+	var q noaa.QuantitativeValue
+	for _, data := range []string{`{"unitCode": "wmoUnit:km_h-1", "value": 20}`, `null`} {
+		if err := json.Unmarshal([]byte(data), &q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.HasValue() || q.Value != 0 || q.UnitCode != "" {
+		t.Errorf("expected null to reset the value, got %+v", q)
+	}
+
+	// values built in Go are used like decoded values
+	hourly := noaa.HourlyForecastResponse{Periods: []noaa.ForecastResponsePeriodHourly{
+		{StartTime: "2023-05-21T14:00:00-05:00", QuantitativeProbability: noaa.QuantitativeValue{Value: 30}},
+		{StartTime: "2023-05-21T15:00:00-05:00", QuantitativeProbability: noaa.NewQuantitativeValue(0, "wmoUnit:percent")},
+	}}
+	if bucket := hourly.Bucket(2 * time.Hour); len(bucket) != 1 || bucket[0].QuantitativeProbability.Value != 30 {
+		t.Errorf("expected the probability built in Go, got %+v", bucket)
+	}
+}
+
+func TestObservationInUnitsNull(t *testing.T) {
+	var observation noaa.Observation
+	data := `{
+		"temperature": {"unitCode": "wmoUnit:degC", "value": null, "qualityControl": "Z"},
+		"dewpoint": {"unitCode": "wmoUnit:degC", "value": 10},
+		"windGust": {"unitCode": "wmoUnit:km_h-1", "value": null}
+	}`
+	if err := json.Unmarshal([]byte(data), &observation); err != nil {
+		t.Fatal(err)
+	}
+	us, err := observation.InUnits("us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if us.Temperature.HasValue() || us.Temperature.Value != 0 || us.Temperature.MinValue != 0 || us.Temperature.MaxValue != 0 {
+		t.Errorf("expected the null temperature to stay null, got %+v", us.Temperature)
+	}
+	if us.WindGust.HasValue() || us.WindGust.Value != 0 {
+		t.Errorf("expected the null wind gust to stay null, got %+v", us.WindGust)
+	}
+	if dewpoint := us.Dewpoint; !dewpoint.HasValue() || dewpoint.Value != 50 || dewpoint.MinValue != 0 || dewpoint.MaxValue != 0 {
+		t.Errorf("expected only the dewpoint value to be converted to 50°F, got %+v", dewpoint)
+	}
+}
+
+func TestObservationInUnits(t *testing.T) {
+	useFixtures(t)
+	observation := noaa.Observation{
+		Temperature: noaa.QuantitativeValue{UnitCode: "wmoUnit:degF", Value: 50},
+		WindSpeed:   noaa.QuantitativeValue{UnitCode: "wmoUnit:km_h-1", Value: 10},
+	}
+	metric, err := observation.InUnits("Metric")
+	if err != nil {
+		t.Fatalf("expected the metric alias to be accepted: %v", err)
+	}
+	if metric.Temperature.Value != 10 || metric.WindSpeed.Value != 10 {
+		t.Errorf("expected 10°C and 10 km/h, got %+v and %+v", metric.Temperature, metric.WindSpeed)
+	}
+	if err := noaa.SetUnits("si"); err != nil {
+		t.Fatal(err)
+	}
+	configured, err := observation.InUnits("")
+	if err != nil || configured.Temperature.Value != 10 {
+		t.Errorf("expected the configured si units for blank units, got %+v, %v", configured, err)
+	}
+	if _, err := observation.InUnits("kelvin"); !errors.Is(err, noaa.ErrInvalidUnits) {
+		t.Errorf("expected ErrInvalidUnits for an invalid value, got %v", err)
+	}
+}
+
+func TestProvenanceDecode(t *testing.T) {
+	useFixtures(t)
+	forecast, err := noaa.Forecast("41.837", "-87.685")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forecast.GeneratedAt != "2023-05-21T14:01:52+00:00" || forecast.ForecastGenerator != "BaselineForecastGenerator" {
+		t.Errorf("expected the generator and time, got %q at %q", forecast.ForecastGenerator, forecast.GeneratedAt)
+	}
+	if !strings.Contains(string(forecast.Context), "@version") {
+		t.Errorf("expected the JSON-LD context, got %s", forecast.Context)
+	}
+	observation, err := noaa.LatestObservation("KORD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(observation.Context), "@version") {
+		t.Errorf("expected the JSON-LD context of the observation, got %s", observation.Context)
+	}
+}
+
+func TestForecastContextCanceled(t *testing.T) {
+	useFixtures(t)
+	noaa.SetClient(&http.Client{Transport: blockingTransport{}})
+	noaa.SetRetries(3, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := noaa.ForecastContext(ctx, "40.1106", "-88.2073") // not cached
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("noaa.ForecastContext() should return promptly once canceled, took %v", elapsed)
+	}
+}
+
+func TestInvalidRequestNotRetried(t *testing.T) {
+	useFixtures(t)
+	t.Cleanup(func() { noaa.SetCircuitBreaker(0, 0) })
+	noaa.SetRetries(3, time.Hour)
+	noaa.SetCircuitBreaker(1, time.Hour)
+
+	start := time.Now()
+	if _, err := noaa.Raw("https://api.weather.gov/%zz"); err == nil {
+		t.Fatal("noaa.Raw() should reject an invalid URL")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("an invalid request should not be retried, took %v", elapsed)
+	}
+	if _, err := noaa.Office("LOT"); err != nil {
+		t.Errorf("an invalid request should not open the circuit breaker: %v", err)
+	}
+}
+
+func TestObservationsDecode(t *testing.T) {
+	useFixtures(t)
+	response, err := noaa.Observations("KORD")
+	if err != nil {
+		t.Fatalf("noaa.Observations() should return observations for KORD: %v", err)
+	}
+	if len(response.Observations) == 0 {
+		t.Fatal("expected at least one observation")
+	}
+	observation := response.Observations[0]
+	if observation.Temperature.Value != 22.2 {
+		t.Errorf("expected temperature 22.2, got %v", observation.Temperature.Value)
+	}
+	if observation.Elevation.Value != 205 {
+		t.Errorf("expected elevation 205, got %v", observation.Elevation.Value)
+	}
+	if len(observation.CloudLayers) == 0 || observation.CloudLayers[0].Amount != "FEW" {
+		t.Errorf("expected the first cloud layer to be FEW, got %+v", observation.CloudLayers)
+	}
+	if response.Pagination.Next == "" {
+		t.Error("expected a pagination cursor")
+	}
+	if observation.METAR() != "KORD 211451Z 22009KT 10SM FEW250 22/10 A3012 RMK AO2 SLP199 T02220100" {
+		t.Errorf("expected the raw METAR, got %q", observation.METAR())
+	}
+}
+
+func TestObservationsMaxPages(t *testing.T) {
+	useFixtures(t)
+	single, err := noaa.Observations("KORD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every page of the fixture has a next cursor so the pages are capped
+	noaa.SetMaxPages(3)
+	response, err := noaa.Observations("KORD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(response.Observations), 3*len(single.Observations); got != want {
+		t.Errorf("expected %d observations from 3 pages, got %d", want, got)
+	}
+}
+
+func TestObservationAt(t *testing.T) {
+	useFixtures(t)
+	at := time.Date(2023, 5, 21, 9, 51, 0, 0, time.FixedZone("CDT", -5*60*60))
+	observation, err := noaa.ObservationAt("KORD", at)
+	if err != nil {
+		t.Fatalf("noaa.ObservationAt() should return the observation at %s: %v", at, err)
+	}
+	if observation.Timestamp != "2023-05-21T14:51:00+00:00" {
+		t.Errorf("expected the observation at 14:51 UTC, got %s", observation.Timestamp)
+	}
+	if _, err := noaa.ObservationAt("KORD", at.Add(time.Minute)); !errors.Is(err, noaa.ErrObservationNotFound) {
+		t.Errorf("expected ErrObservationNotFound, got %v", err)
+	}
+}
+
+func TestLatestMETAR(t *testing.T) {
+	useFixtures(t)
+	metar, err := noaa.LatestMETAR("KORD")
+	if err != nil {
+		t.Fatalf("noaa.LatestMETAR() should return the METAR for KORD: %v", err)
+	}
+	if !strings.HasPrefix(metar, "KORD 211451Z") {
+		t.Errorf("expected the latest METAR, got %q", metar)
+	}
+}
+
+func TestDebugRawResponse(t *testing.T) {
+	useFixtures(t)
+	noaa.SetDebug(true)
+	if _, err := noaa.Observations("KORD"); err != nil {
+		t.Fatalf("noaa.Observations() should return observations for KORD: %v", err)
+	}
+	body, status := noaa.LastRawResponse("https://api.weather.gov/stations/KORD/observations")
+	if status != http.StatusOK || !strings.Contains(string(body), "rawMessage") {
+		t.Errorf("expected the recorded observations response, got %d %q", status, body)
+	}
+
+	noaa.Office("XXX")
+	if _, status := noaa.LastRawResponse("https://api.weather.gov/offices/XXX"); status != http.StatusNotFound {
+		t.Errorf("expected a recorded 404, got %d", status)
+	}
+}
+
+func TestOnResponse(t *testing.T) {
+	useFixtures(t)
+	type response struct {
+		endpoint string
+		status   int
+		bytes    int
+	}
+	var responses []response
+	noaa.SetOnResponse(func(endpoint string, status int, bytes int, dur time.Duration) {
+		responses = append(responses, response{endpoint, status, bytes})
+	})
+	noaa.Office("LOT")
+	noaa.Office("XXX")
+
+	info, err := os.Stat("testdata/office_lot.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []response{
+		{"https://api.weather.gov/offices/LOT", http.StatusOK, int(info.Size())},
+		{"https://api.weather.gov/offices/XXX", http.StatusNotFound, 0},
+	}
+	if !reflect.DeepEqual(responses, want) {
+		t.Errorf("expected responses %+v, got %+v", want, responses)
+	}
+}
+
+func TestHourlyValidUntil(t *testing.T) {
+	tests := []struct {
+		validTimes string
+		want       string
+	}{
+		{"2023-05-21T14:00:00+00:00/P7DT11H", "2023-05-29T01:00:00Z"},
+		{"2023-05-21T14:00:00+00:00/PT30M", "2023-05-21T14:30:00Z"},
+		{"2023-05-21T14:00:00+00:00/P1W", "2023-05-28T14:00:00Z"},
+		{"2023-05-21T14:00:00+00:00/2023-05-22T02:00:00+00:00", "2023-05-22T02:00:00Z"},
+		{"PT12H/2023-05-22T02:00:00+00:00", "2023-05-22T02:00:00Z"},
+	}
+	for _, test := range tests {
+		hourly := noaa.HourlyForecastResponse{ValidTimes: test.validTimes}
+		until, err := hourly.ValidUntil()
+		if err != nil {
+			t.Errorf("ValidUntil() for %q returned an error: %v", test.validTimes, err)
+			continue
+		}
+		if got := until.UTC().Format(time.RFC3339); got != test.want {
+			t.Errorf("ValidUntil() for %q = %s, want %s", test.validTimes, got, test.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "2023-05-21T14:00:00+00:00", "2023-05-21T14:00:00+00:00/P", "2023-05-21T14:00:00+00:00/PT3X"} {
+		hourly := noaa.HourlyForecastResponse{ValidTimes: invalid}
+		if _, err := hourly.ValidUntil(); err == nil {
+			t.Errorf("ValidUntil() for %q should return an error", invalid)
+		}
+	}
+}
+
+func TestParseIcon(t *testing.T) {
+	tests := []struct {
+		icon      string
+		condition string
+		isDay     bool
+		coverage  int
+	}{
+		{"https://api.weather.gov/icons/land/day/sct?size=medium", "sct", true, 0},
+		{"https://api.weather.gov/icons/land/night/rain_showers,40/tsra,70?size=medium", "rain_showers", false, 40},
+		{"https://api.weather.gov/icons/marine/day/tsra_hi,20", "tsra_hi", true, 20},
+	}
+	for _, test := range tests {
+		period := noaa.ForecastResponsePeriod{Icon: test.icon}
+		condition, isDay, coverage, err := period.ParseIcon()
+		if err != nil {
+			t.Errorf("ParseIcon() for %q returned an error: %v", test.icon, err)
+			continue
+		}
+		if condition != test.condition || isDay != test.isDay || coverage != test.coverage {
+			t.Errorf("ParseIcon() for %q = %q, %v, %d, want %q, %v, %d", test.icon,
+				condition, isDay, coverage, test.condition, test.isDay, test.coverage)
+		}
+	}
+
+	for _, invalid := range []string{"", "https://api.weather.gov/icons/land/dusk/sct", "https://api.weather.gov/icons/land/day/sct,x"} {
+		period := noaa.ForecastResponsePeriod{Icon: invalid}
+		if _, _, _, err := period.ParseIcon(); err == nil {
+			t.Errorf("ParseIcon() for %q should return an error", invalid)
+		}
+	}
+}
+
+func TestGeoJSONDecode(t *testing.T) {
+	useFixtures(t)
+	noaa.SetClient(&http.Client{Transport: geoFixtures})
+	noaa.SetAcceptHeader("application/geo+json")
+
+	point, err := noaa.Points("39.7456", "-97.0892")
+	if err != nil {
+		t.Fatalf("noaa.Points() should decode a GeoJSON point: %v", err)
+	}
+	if point.CWA != "TOP" || point.GridX != 32 || point.GridY != 81 {
+		t.Errorf("expected the TOP/32,81 grid, got %s", point.GridID())
+	}
+
+	response, err := noaa.Observations("KORD")
+	if err != nil {
+		t.Fatalf("noaa.Observations() should decode a GeoJSON collection: %v", err)
+	}
+	if len(response.Observations) != 1 || response.Observations[0].Temperature.Value != 22.2 {
+		t.Errorf("expected one observation of 22.2, got %+v", response.Observations)
+	}
+	if response.Pagination.Next == "" {
+		t.Error("expected the pagination cursor to be preserved")
+	}
+}
+
+// TestJSONTags audits the response types for exported fields that are missing
+// a json tag, which would silently leave them empty when decoding responses.
+func TestJSONTags(t *testing.T) {
+	untagged := map[string]bool{
+		"Point":       true, // set by the client, not decoded
+		"Temperature": true, // see ForecastResponsePeriod.UnmarshalJSON
+		"WindSpeed":   true, // see ForecastResponsePeriod.UnmarshalJSON
+	}
+	types := []any{
+		noaa.PointsResponse{},
+		noaa.OfficeResponse{},
+		noaa.StationsResponse{},
+		noaa.AlertsCount{},
+		noaa.AlertsResponse{},
+		noaa.Alert{},
+		noaa.Observation{},
+		noaa.ObservationsResponse{},
+		noaa.CloudLayerReading{},
+		noaa.ForecastResponse{},
+		noaa.ForecastResponsePeriod{},
+		noaa.HourlyForecastResponse{},
+		noaa.GridpointForecastResponse{},
+		noaa.ZoneForecastResponse{},
+	}
+	for _, v := range types {
+		typ := reflect.TypeOf(v)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.IsExported() && field.Tag.Get("json") == "" && !untagged[field.Name] {
+				t.Errorf("%s.%s is missing a json tag", typ.Name(), field.Name)
+			}
+		}
+	}
+
+	// the legacy period fields share their keys with the QV fields
+	data, err := json.Marshal(noaa.ForecastResponsePeriod{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys map[string]any
+	if err := json.Unmarshal(data, &keys); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"temperature", "temperatureUnit", "windSpeed", "windGust"} {
+		if _, ok := keys[key]; !ok {
+			t.Errorf("expected ForecastResponsePeriod to marshal the %q key", key)
+		}
+	}
+}
+
+func TestDedupeByEvent(t *testing.T) {
+	response := noaa.AlertsResponse{Alerts: []noaa.Alert{
+		{Event: "Winter Weather Advisory", Severity: noaa.SeverityModerate, AreaDesc: "Cook; DuPage", AffectedZones: []string{"ILZ014"},
+			Effective: "2023-01-10T06:00:00-06:00", Expires: "2023-01-10T18:00:00-06:00"},
+		{Event: "Flood Warning", Severity: noaa.SeveritySevere, AreaDesc: "Will",
+			Effective: "2023-01-10T06:00:00-06:00", Expires: "2023-01-11T06:00:00-06:00"},
+		{Event: "Winter Weather Advisory", Severity: noaa.SeverityModerate, AreaDesc: "DuPage; Lake", AffectedZones: []string{"ILZ013"},
+			Effective: "2023-01-10T03:00:00-06:00", Expires: "2023-01-10T12:00:00-06:00"},
+		{Event: "Winter Weather Advisory", Severity: noaa.SeverityModerate, AreaDesc: "Kane",
+			Effective: "2023-01-12T06:00:00-06:00", Expires: "2023-01-12T18:00:00-06:00"},
+	}}
+	alerts := response.DedupeByEvent()
+	if len(alerts) != 3 {
+		t.Fatalf("expected 3 alerts after merging the overlapping advisories, got %d", len(alerts))
+	}
+	merged := alerts[0]
+	if merged.AreaDesc != "Cook; DuPage; Lake" || len(merged.AffectedZones) != 2 {
+		t.Errorf("expected the areas and zones to be combined, got %q %v", merged.AreaDesc, merged.AffectedZones)
+	}
+	if merged.Effective != "2023-01-10T03:00:00-06:00" || merged.Expires != "2023-01-10T18:00:00-06:00" {
+		t.Errorf("expected the widest window, got %s to %s", merged.Effective, merged.Expires)
+	}
+	if !merged.Severity.AtLeast(noaa.SeverityMinor) || merged.Severity.AtLeast(noaa.SeveritySevere) {
+		t.Errorf("expected a moderate severity, got %s", merged.Severity)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	useFixtures(t)
+	noaa.SetMaxPages(2)
+	alerts, err := noaa.Alerts(noaa.AlertQuery{
+		Start: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC),
+		Area:  []string{"il"},
+	})
+	if err != nil {
+		t.Fatalf("noaa.Alerts() should return the alerts for IL: %v", err)
+	}
+	// every page of the fixture has a next cursor so the pages are capped
+	if len(alerts.Alerts) != 2 {
+		t.Fatalf("expected 2 alerts from 2 pages, got %d", len(alerts.Alerts))
+	}
+	alert := alerts.Alerts[0]
+	if alert.Event != "Winter Weather Advisory" || alert.Severity != noaa.SeverityModerate || alert.Urgency != noaa.UrgencyExpected {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+}
+
+func TestAlertsAllPages(t *testing.T) {
+	useFixtures(t)
+	alerts, err := noaa.Alerts(noaa.AlertQuery{Area: []string{"IL"}})
+	if err != nil {
+		t.Fatalf("noaa.Alerts() should return the alerts for IL: %v", err)
+	}
+	// the second page of the fixture links back to itself so it is the last
+	if len(alerts.Alerts) != 2 {
+		t.Fatalf("expected 2 alerts from every page, got %d", len(alerts.Alerts))
+	}
+}
+
+func TestAlertsNextPage(t *testing.T) {
+	useFixtures(t)
+	noaa.SetMaxPages(1)
+	alerts, err := noaa.Alerts(noaa.AlertQuery{Area: []string{"IL"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := alerts.NextPage()
+	if err != nil || next == nil || len(next.Alerts) != 1 {
+		t.Fatalf("expected the next page of alerts, got %+v, %v", next, err)
+	}
+	last, err := (&noaa.AlertsResponse{}).NextPage()
+	if last != nil || err != nil {
+		t.Errorf("expected no page after the last one, got %+v, %v", last, err)
+	}
+}
+
+func TestNearestStations(t *testing.T) {
+	useFixtures(t)
+	stations, err := noaa.NearestStations("41.837", "-87.685", 2)
+	if err != nil {
+		t.Fatalf("noaa.NearestStations() should return the stations near Chicago: %v", err)
+	}
+	if len(stations) != 2 || stations[0].StationIdentifier != "KMDW" || stations[1].StationIdentifier != "KORD" {
+		t.Fatalf("expected KMDW and KORD, got %+v", stations)
+	}
+	if d := stations[0].Distance; d < 8 || d > 8.2 {
+		t.Errorf("expected KMDW to be about 8.1 km away, got %.2f km", d)
+	}
+}
+
+func TestForecastDigest(t *testing.T) {
+	useFixtures(t)
+	forecast, err := noaa.Forecast("41.837", "-87.685")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Today: Sunny, high 76°F. Tonight: Mostly Clear, low 56°F."
+	if got := forecast.Digest(2); got != want {
+		t.Errorf("Digest(2) = %q, want %q", got, want)
+	}
+	if got := forecast.Digest(0); got != "" {
+		t.Errorf("Digest(0) = %q, want an empty digest", got)
+	}
+}
+
+func TestForecastWindGust(t *testing.T) {
+	useFixtures(t)
+	forecast, err := noaa.Forecast("41.837", "-87.685")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forecast.Periods[0].WindGust != "" || forecast.Periods[2].WindGust != "25 mph" {
+		t.Errorf("expected no gusts today and 25 mph gusts on Monday, got %q and %q",
+			forecast.Periods[0].WindGust, forecast.Periods[2].WindGust)
+	}
+}
+
+// chicagoLocations returns n distinct locations whose point lookups are served
+// the Chicago point by chicagoPoints.
+func chicagoLocations(n int) []noaa.Location {
+	locations := make([]noaa.Location, n)
+	for i := range locations {
+		locations[i] = noaa.Location{Lat: "41.837", Lon: fmt.Sprintf("-87.%d", 600+i)}
+	}
+	return locations
+}
+
+// chicagoPoints serves the recorded responses like apiFixtures but with the
+// Chicago point for every point lookup at its latitude.
+func chicagoPoints(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.Path, "/points/41.837,") {
+		req = req.Clone(req.Context())
+		req.URL.Path = "/points/41.837,-87.685"
+	}
+	return apiFixtures.RoundTrip(req)
+}
+
+func TestForecastBatchUnits(t *testing.T) {
+	useFixtures(t)
+	var once sync.Once
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		// change the units while the batch is running
+		once.Do(func() { noaa.SetUnits("si") })
+		return chicagoPoints(req)
+	}))
+	locations := chicagoLocations(20)
+	forecasts, errs := noaa.ForecastBatch(context.Background(), append(locations, locations[0]))
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if len(forecasts) != len(locations) {
+		t.Fatalf("expected one forecast per distinct location, got %d", len(forecasts))
+	}
+	for location, forecast := range forecasts {
+		if unit := forecast.Periods[0].TemperatureUnit; unit != "F" {
+			t.Errorf("forecast for %v should use the units from the start of the batch, got %s", location, unit)
+		}
+	}
+	if units := noaa.GetConfig().Units; units != "si" {
+		t.Errorf("expected SetUnits to change the config for later calls, got %q", units)
+	}
+}
+
+func TestForecastBatchErrors(t *testing.T) {
+	useFixtures(t)
+	noaa.SetClient(doerFunc(chicagoPoints))
+	invalid := noaa.Location{Lat: "0", Lon: "0"}
+	locations := append([]noaa.Location{invalid}, chicagoLocations(20)...)
+	forecasts, errs := noaa.ForecastBatch(context.Background(), locations)
+	if !noaa.IsOutsideUS(errs[invalid]) || forecasts[invalid] != nil {
+		t.Errorf("expected the invalid location to fail, got %v", errs[invalid])
+	}
+	for _, location := range locations[1:] {
+		if errs[location] != nil || forecasts[location] == nil {
+			t.Errorf("forecast for %v should not be affected by the invalid location: %v", location, errs[location])
+		}
+	}
+
+	// delay the valid locations so that the invalid one fails first
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		if !strings.HasPrefix(req.URL.Path, "/points/0,") {
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		return chicagoPoints(req)
+	}))
+	forecasts, errs = noaa.ForecastBatch(context.Background(), locations, noaa.WithStopOnFirstError(true))
+	if !noaa.IsOutsideUS(errs[invalid]) {
+		t.Errorf("expected the invalid location to fail, got %v", errs[invalid])
+	}
+	if len(forecasts) != 0 {
+		t.Errorf("expected no forecasts, got %d", len(forecasts))
+	}
+	for _, location := range locations[1:] {
+		if !errors.Is(errs[location], noaa.ErrBatchStopped) {
+			t.Errorf("forecast for %v should be stopped, got %v", location, errs[location])
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("NOAA_USER_AGENT", "(example.com, contact@example.com)")
+	t.Setenv("NOAA_UNITS", "SI")
+	t.Setenv("NOAA_RETRIES", "3")
+	t.Setenv("NOAA_RETRY_DELAY", "500ms")
+	config, err := noaa.ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("noaa.ConfigFromEnv() returned an error: %v", err)
+	}
+	if config.UserAgent != "(example.com, contact@example.com)" || config.Units != "si" ||
+		config.Retries != 3 || config.RetryDelay != 500*time.Millisecond {
+		t.Errorf("expected the values from the environment, got %+v", config)
+	}
+	if config.BaseURL != noaa.API || config.Accept != noaa.APIAccept {
+		t.Errorf("expected the defaults for unset variables, got %+v", config)
+	}
+
+	t.Setenv("NOAA_UNITS", "Metric")
+	if config, err := noaa.ConfigFromEnv(); err != nil || config.Units != "si" {
+		t.Errorf("expected the metric alias to be si, got %q, %v", config.Units, err)
+	}
+	t.Setenv("NOAA_UNITS", "kelvin")
+	if _, err := noaa.ConfigFromEnv(); !errors.Is(err, noaa.ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig for invalid units, got %v", err)
+	}
+	t.Setenv("NOAA_UNITS", "si")
+
+	t.Setenv("NOAA_RETRIES", "three")
+	if _, err := noaa.ConfigFromEnv(); !errors.Is(err, noaa.ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig for an invalid number, got %v", err)
+	}
+}
+
+func TestObservationForPoint(t *testing.T) {
+	useFixtures(t)
+	observation, err := noaa.ObservationForPoint("41.837", "-87.685", "kord")
+	if err != nil {
+		t.Fatalf("noaa.ObservationForPoint() should return the observation for KORD: %v", err)
+	}
+	if !strings.HasPrefix(observation.METAR(), "KORD") {
+		t.Errorf("expected an observation from KORD, got %q", observation.METAR())
+	}
+	if _, err := noaa.ObservationForPoint("41.837", "-87.685", "KSFO"); err == nil {
+		t.Error("noaa.ObservationForPoint() should reject a station that does not belong to the point")
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	useFixtures(t)
+	t.Cleanup(func() { noaa.SetCircuitBreaker(0, 0) })
+	var requests int32
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return fixtureResponse(req, http.StatusServiceUnavailable, nil), nil
+	}))
+	noaa.SetCircuitBreaker(2, time.Hour)
+	for i := 0; i < 2; i++ {
+		if _, err := noaa.Office("LOT"); err == nil || errors.Is(err, noaa.ErrCircuitOpen) {
+			t.Fatalf("request %d should fail with the API error, got %v", i, err)
+		}
+	}
+	if _, err := noaa.Office("LOT"); !errors.Is(err, noaa.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen after 2 failures, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected no request while the circuit is open, got %d requests", n)
+	}
+
+	// after the cooldown a successful probe closes the circuit
+	noaa.SetCircuitBreaker(1, 10*time.Millisecond)
+	noaa.Office("LOT")
+	if _, err := noaa.Office("LOT"); !errors.Is(err, noaa.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen after 1 failure, got %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	noaa.SetClient(&http.Client{Transport: apiFixtures})
+	for i := 0; i < 2; i++ {
+		if _, err := noaa.Office("LOT"); err != nil {
+			t.Errorf("request %d should succeed once the circuit is closed: %v", i, err)
+		}
+	}
+}
+
+func TestCircuitBreakerCanceledProbe(t *testing.T) {
+	useFixtures(t)
+	t.Cleanup(func() { noaa.SetCircuitBreaker(0, 0) })
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		return fixtureResponse(req, http.StatusServiceUnavailable, nil), nil
+	}))
+	noaa.SetCircuitBreaker(2, 50*time.Millisecond)
+	noaa.Office("LOT")
+	noaa.Office("LOT")
+	time.Sleep(60 * time.Millisecond)
+
+	// the probe is canceled while it waits to retry
+	noaa.SetRetries(1, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := noaa.StationsContext(ctx, "41.837", "-87.685"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the probe to be canceled, got %v", err)
+	}
+
+	// the canceled probe neither leaves the breaker stuck nor closes it
+	noaa.SetRetries(0, 0)
+	var apiErr *noaa.APIError
+	if _, err := noaa.Office("LOT"); !errors.As(err, &apiErr) {
+		t.Fatalf("expected another probe after the canceled one, got %v", err)
+	}
+	if _, err := noaa.Office("LOT"); !errors.Is(err, noaa.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen after the failed probe, got %v", err)
+	}
+}
+
+func TestForecastElevationMeters(t *testing.T) {
+	tests := []struct {
+		elevation noaa.ForecastElevation
+		want      float64
+	}{
+		{noaa.ForecastElevation{Value: 180.1392, Units: "wmoUnit:m"}, 180.1392},
+		{noaa.ForecastElevation{Value: 591, Units: "wmoUnit:ft"}, 180.1368},
+		{noaa.ForecastElevation{Value: 180}, 180},
+	}
+	for _, tt := range tests {
+		if got := tt.elevation.Meters(); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%v %s: expected %v m, got %v", tt.elevation.Value, tt.elevation.Units, tt.want, got)
+		}
+	}
+}
+
+func TestListStations(t *testing.T) {
+	useFixtures(t)
+	noaa.SetMaxPages(2)
+	var query string
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		if query == "" {
+			query = req.URL.RawQuery
+		}
+		return apiFixtures.RoundTrip(req)
+	}))
+	stations, err := noaa.ListStations(noaa.StationQuery{State: []string{"il"}, Limit: 2})
+	if err != nil {
+		t.Fatalf("noaa.ListStations() should return the stations in IL: %v", err)
+	}
+	if query != "limit=2&state=IL" {
+		t.Errorf("unexpected query %q", query)
+	}
+	// every page of the fixture has a next cursor so the pages are capped
+	if len(stations.Stations) != 4 {
+		t.Fatalf("expected 4 stations from 2 pages, got %d", len(stations.Stations))
+	}
+	if station := stations.Stations[1]; station.StationIdentifier != "KSPI" || station.Name != "Springfield, Capital Airport" {
+		t.Errorf("unexpected station %+v", station)
+	}
+}
+
+func TestForecastGeneratorChanged(t *testing.T) {
+	useFixtures(t)
+	if _, err := noaa.HourlyForecast("41.837", "-87.685"); err != nil {
+		t.Fatalf("noaa.HourlyForecast() should return the fixture: %v", err)
+	}
+	if changed, first, latest := noaa.ForecastGeneratorChanged(); changed || first != "HourlyForecastGenerator" || latest != first {
+		t.Fatalf("expected an unchanged HourlyForecastGenerator, got %v %q %q", changed, first, latest)
+	}
+
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := apiFixtures.RoundTrip(req)
+		if err != nil || !strings.HasSuffix(req.URL.Path, "/hourly") {
+			return res, err
+		}
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = []byte(strings.Replace(string(body), "HourlyForecastGenerator", "HourlyForecastGeneratorV2", 1))
+		return fixtureResponse(req, res.StatusCode, body), nil
+	}))
+	if _, err := noaa.HourlyForecast("41.837", "-87.685"); err != nil {
+		t.Fatalf("noaa.HourlyForecast() should return the changed fixture: %v", err)
+	}
+	if changed, first, latest := noaa.ForecastGeneratorChanged(); !changed || first != "HourlyForecastGenerator" || latest != "HourlyForecastGeneratorV2" {
+		t.Errorf("expected a changed generator, got %v %q %q", changed, first, latest)
+	}
+
+	// switching back to the first generator is no longer a change
+	noaa.SetClient(&http.Client{Transport: apiFixtures})
+	if _, err := noaa.HourlyForecast("41.837", "-87.685"); err != nil {
+		t.Fatalf("noaa.HourlyForecast() should return the fixture: %v", err)
+	}
+	if changed, _, _ := noaa.ForecastGeneratorChanged(); changed {
+		t.Error("expected the generator to be unchanged again")
+	}
+}
+
+func TestForecastCacheTTL(t *testing.T) {
+	useFixtures(t)
+	var requests int32
+	validTimes := time.Now().UTC().Format(time.RFC3339) + "/PT2H"
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		res, err := apiFixtures.RoundTrip(req)
+		if err != nil || !strings.HasSuffix(req.URL.Path, "/hourly") {
+			return res, err
+		}
+		atomic.AddInt32(&requests, 1)
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = []byte(strings.Replace(string(body), "2023-05-21T14:00:00+00:00/P7DT11H", validTimes, 1))
+		return fixtureResponse(req, res.StatusCode, body), nil
+	}))
+	noaa.SetForecastCacheTTL(time.Hour)
+
+	first, err := noaa.HourlyForecast("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.HourlyForecast() should return the fixture: %v", err)
+	}
+	first.Periods[0].Summary = "changed by the caller"
+	second, err := noaa.HourlyForecast("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.HourlyForecast() should return the cached forecast: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected the forecast to be cached, got %d requests", n)
+	}
+	if second.Periods[0].Summary == "changed by the caller" {
+		t.Error("expected the cached forecast to be a copy")
+	}
+	if _, err := noaa.HourlyForecast("41.837", "-87.685", noaa.WithFeatureFlags()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected other feature flags to be requested, got %d requests", n)
+	}
+
+	// a forecast that is no longer valid is not cached
+	validTimes = "2023-05-21T14:00:00+00:00/P7DT11H"
+	noaa.SetUnits("si")
+	for i := 0; i < 2; i++ {
+		if _, err := noaa.HourlyForecast("41.837", "-87.685"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 4 {
+		t.Errorf("expected an expired forecast to be requested again, got %d requests", n)
+	}
+}
+
+func TestTotalPrecipitation(t *testing.T) {
+	gridpoint := noaa.GridpointForecastResponse{
+		QuantitativePrecipitation: noaa.GridpointForecastTimeSeries{
+			Uom: "wmoUnit:mm",
+			Values: []noaa.GridpointForecastTimeSeriesValue{
+				{ValidTime: "2019-07-04T00:00:00+00:00/PT6H", Value: 6},
+				{ValidTime: "2019-07-04T06:00:00+00:00/PT6H", Value: 3},
+				{ValidTime: "2019-07-04T12:00:00+00:00/PT12H", Value: 12},
+			},
+		},
+	}
+	// half of the first and last intervals are inside the window
+	start := time.Date(2019, 7, 4, 3, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 7, 4, 18, 0, 0, 0, time.UTC)
+	total, unit := gridpoint.TotalPrecipitation(start, end)
+	if total != 12 || unit != "wmoUnit:mm" {
+		t.Errorf("expected 12 wmoUnit:mm, got %v %s", total, unit)
+	}
+	if total, _ := gridpoint.TotalPrecipitation(end.Add(24*time.Hour), end.Add(48*time.Hour)); total != 0 {
+		t.Errorf("expected no precipitation outside of the series, got %v", total)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	useFixtures(t)
+	noaa.SetClient(&http.Client{Transport: fixtures{"/stations/KORD": "station_kord.json"}})
+	if _, err := noaa.Station("KORD"); err != nil {
+		t.Fatalf("unknown fields should be ignored by default: %v", err)
+	}
+	noaa.SetStrictDecoding(true)
+	_, err := noaa.Station("KORD")
+	if err == nil || !strings.Contains(err.Error(), `unknown field "provider"`) {
+		t.Errorf("expected an unknown field error in strict mode, got %v", err)
+	}
+}
+
+func TestCWSU(t *testing.T) {
+	useFixtures(t)
+	cwsu, err := noaa.CWSU("ZAU")
+	if err != nil {
+		t.Fatalf("noaa.CWSU() should return the Chicago CWSU: %v", err)
+	}
+	if cwsu.ID != "ZAU" || cwsu.City != "Aurora" || cwsu.NWSRegion != "cr" {
+		t.Errorf("unexpected CWSU %+v", cwsu)
+	}
+	cwas, err := noaa.CWAs("ZAU")
+	if err != nil {
+		t.Fatalf("noaa.CWAs() should return the Chicago CWAs: %v", err)
+	}
+	if len(cwas.Advisories) != 1 {
+		t.Fatalf("expected 1 advisory, got %d", len(cwas.Advisories))
+	}
+	cwa := cwas.Advisories[0]
+	if cwa.Sequence != 101 || cwa.ObservedProperty != "CONVECTIVE" || !strings.Contains(cwa.Text, "SCT TS") {
+		t.Errorf("unexpected advisory %+v", cwa)
+	}
+}
+
+func TestSIGMETs(t *testing.T) {
+	useFixtures(t)
+	var query string
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		query = req.URL.RawQuery
+		return apiFixtures.RoundTrip(req)
+	}))
+	sigmets, err := noaa.SIGMETs(noaa.SIGMETQuery{
+		Date: time.Date(2023, 5, 21, 20, 0, 0, 0, time.FixedZone("CDT", -5*60*60)),
+		ATSU: "kkci",
+	})
+	if err != nil {
+		t.Fatalf("noaa.SIGMETs() should return the SIGMETs: %v", err)
+	}
+	if query != "atsu=KKCI&date=2023-05-22" {
+		t.Errorf("unexpected query %q", query)
+	}
+	if len(sigmets.SIGMETs) != 2 {
+		t.Fatalf("expected 2 SIGMETs, got %d", len(sigmets.SIGMETs))
+	}
+	sigmet := sigmets.SIGMETs[1]
+	if sigmet.Sequence != "TANGO 2" || sigmet.Phenomenon != "TURB" || sigmet.ExpireTime != "2023-05-21T18:00:00+00:00" {
+		t.Errorf("unexpected SIGMET %+v", sigmet)
+	}
+	if !strings.HasPrefix(sigmets.SIGMETs[0].Area, "POLYGON") {
+		t.Errorf("expected the area of the first SIGMET, got %q", sigmets.SIGMETs[0].Area)
+	}
+}
+
+func TestSIGMETDecode(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sigmets_kkci.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sigmets noaa.SIGMETsResponse
+	if err := json.Unmarshal(data, &sigmets); err != nil {
+		t.Fatalf("decoding the SIGMETs should not fail: %v", err)
+	}
+	want := []noaa.SIGMET{
+		{
+			ID:         "https://api.weather.gov/aviation/sigmets/KKCI/2023-05-21/1455/26C",
+			IssueTime:  "2023-05-21T14:55:00+00:00",
+			ATSU:       "KKCI",
+			Sequence:   "26C",
+			Start:      "2023-05-21T14:55:00+00:00",
+			ExpireTime: "2023-05-21T16:55:00+00:00",
+			Area:       "POLYGON((-88.5 42.5,-86.9 42.1,-87.4 40.9,-89.2 41.3,-88.5 42.5))",
+		},
+		{
+			ID:         "https://api.weather.gov/aviation/sigmets/KKCI/2023-05-21/1400/TANGO2",
+			IssueTime:  "2023-05-21T14:00:00+00:00",
+			ATSU:       "KKCI",
+			Sequence:   "TANGO 2",
+			Phenomenon: "TURB",
+			Start:      "2023-05-21T14:00:00+00:00",
+			ExpireTime: "2023-05-21T18:00:00+00:00",
+		},
+	}
+	if !reflect.DeepEqual(sigmets.SIGMETs, want) {
+		t.Errorf("expected every field to be decoded:\n%+v\ngot:\n%+v", want, sigmets.SIGMETs)
+	}
+}
+
+func TestForecastByZip(t *testing.T) {
+	useFixtures(t)
+	t.Cleanup(noaa.ResetZipCodes)
+	err := noaa.LoadZipCodes(strings.NewReader("zip,lat,lon\n60629,41.837,-87.685\n"))
+	if err != nil {
+		t.Fatalf("noaa.LoadZipCodes() should load the ZIP codes: %v", err)
+	}
+	forecast, err := noaa.ForecastByZip("60629-1234")
+	if err != nil {
+		t.Fatalf("noaa.ForecastByZip() should return the forecast for Chicago: %v", err)
+	}
+	if forecast.Point == nil || forecast.Point.CWA != "LOT" {
+		t.Errorf("expected the forecast for the LOT grid, got %+v", forecast.Point)
+	}
+	if _, err := noaa.ForecastByZip("99999"); !errors.Is(err, noaa.ErrUnknownZip) {
+		t.Errorf("expected ErrUnknownZip, got %v", err)
+	}
+	for _, zip := range []string{"", "6062", "60629-12", "ABCDE"} {
+		if _, err := noaa.ForecastByZip(zip); !errors.Is(err, noaa.ErrInvalidZip) {
+			t.Errorf("noaa.ForecastByZip(%q) should return ErrInvalidZip, got %v", zip, err)
+		}
+	}
+	if err := noaa.RegisterZipCode("60629", "north", "-87.685"); err == nil {
+		t.Error("noaa.RegisterZipCode() should reject an invalid latitude")
+	}
+}
+
+func TestForecastByZipBundled(t *testing.T) {
+	useFixtures(t)
+	t.Cleanup(noaa.ResetZipCodes)
+	var points string
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(req.URL.Path, "/points/") {
+			points = req.URL.Path
+			req.URL.Path = "/points/41.837,-87.685" // serve the Chicago fixture
+		}
+		return apiFixtures.RoundTrip(req)
+	}))
+
+	forecast, err := noaa.ForecastByZip("60601")
+	if err != nil {
+		t.Fatalf("noaa.ForecastByZip() should resolve a bundled ZIP code: %v", err)
+	}
+	if points != "/points/41.8858,-87.6181" {
+		t.Errorf("expected the bundled centroid of 60601, got %q", points)
+	}
+	if forecast.Point == nil || forecast.Point.CWA != "LOT" {
+		t.Errorf("expected the forecast for the LOT grid, got %+v", forecast.Point)
+	}
+
+	if err := noaa.RegisterZipCode("60601", "41.8", "-87.6"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noaa.ForecastByZip("60601"); err != nil {
+		t.Fatalf("noaa.ForecastByZip() should resolve a registered ZIP code: %v", err)
+	}
+	if points != "/points/41.8,-87.6" {
+		t.Errorf("expected the registered centroid to take precedence, got %q", points)
+	}
+}
+
+func TestApparentTemperature(t *testing.T) {
+	humidity := func(percent float64) noaa.QuantitativeValue {
+		return noaa.NewQuantitativeValue(percent, "wmoUnit:percent")
+	}
+	wind := func(mph float64) noaa.QuantitativeValue {
+		return noaa.NewQuantitativeValue(mph, "wmoUnit:mi_h-1")
+	}
+	// expected values from the NWS heat index and wind chill charts
+	tests := []struct {
+		name   string
+		period noaa.ForecastResponsePeriod
+		want   float64
+		unit   string
+	}{
+		{"heat index", noaa.ForecastResponsePeriod{Temperature: 90, TemperatureUnit: "F", QuantitativeRelativeHumidity: humidity(70)}, 106, "F"},
+		{"heat index dry", noaa.ForecastResponsePeriod{Temperature: 100, TemperatureUnit: "F", QuantitativeRelativeHumidity: humidity(40)}, 109, "F"},
+		{"heat index si", noaa.ForecastResponsePeriod{Temperature: 32.2, TemperatureUnit: "C", QuantitativeRelativeHumidity: humidity(70)}, 41, "C"},
+		{"wind chill", noaa.ForecastResponsePeriod{Temperature: 0, TemperatureUnit: "F", QuantitativeWindSpeed: wind(15)}, -19, "F"},
+		{"wind chill range", noaa.ForecastResponsePeriod{Temperature: 30, TemperatureUnit: "F", QuantitativeWindSpeed: noaa.QuantitativeValue{MinValue: 5, MaxValue: 10, UnitCode: "wmoUnit:mi_h-1"}}, 21, "F"},
+		{"wind chill si", noaa.ForecastResponsePeriod{Temperature: -23.3, TemperatureUnit: "C", QuantitativeWindSpeed: wind(20)}, -37, "C"},
+		{"calm", noaa.ForecastResponsePeriod{Temperature: 65, TemperatureUnit: "F", QuantitativeWindSpeed: wind(10), QuantitativeRelativeHumidity: humidity(50)}, 65, "F"},
+	}
+	for _, tt := range tests {
+		got, unit, err := tt.period.ApparentTemperature()
+		if err != nil || math.Round(got) != tt.want || unit != tt.unit {
+			t.Errorf("%s: expected %v°%s, got %.1f°%s, %v", tt.name, tt.want, tt.unit, got, unit, err)
+		}
+	}
+	if _, _, err := (noaa.ForecastResponsePeriod{}).ApparentTemperature(); err == nil {
+		t.Error("expected an error for a period without a temperature")
+	}
+
+	// the unit follows the forecast, not the configured units
+	useFixtures(t)
+	noaa.SetUnits("us")
+	forecast, err := noaa.ForecastUnits("41.837", "-87.685", "si")
+	if err != nil {
+		t.Fatalf("noaa.ForecastUnits() should return the fixture: %v", err)
+	}
+	if _, unit, err := forecast.Periods[0].ApparentTemperature(); err != nil || unit != "C" {
+		t.Errorf("expected the apparent temperature of an si forecast in °C, got °%s, %v", unit, err)
+	}
+}
+
+func TestMaxPrecipProbability(t *testing.T) {
+	useFixtures(t)
+	forecast, err := noaa.HourlyForecast("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.HourlyForecast() should return the fixture: %v", err)
+	}
+	from := time.Date(2023, 5, 21, 14, 30, 0, 0, time.FixedZone("CDT", -5*60*60))
+	tests := []struct {
+		from    time.Time
+		window  time.Duration
+		percent float64
+		at      string
+	}{
+		{from, 3 * time.Hour, 15, "2023-05-21T17:00:00-05:00"},
+		{from, 6 * time.Hour, 60, "2023-05-21T19:00:00-05:00"},
+		{from.Add(6 * time.Hour), 2 * time.Hour, 40, "2023-05-21T20:00:00-05:00"},
+	}
+	for _, tt := range tests {
+		percent, at := forecast.MaxPrecipProbabilityFrom(tt.from, tt.window)
+		if percent != tt.percent || at.Format(time.RFC3339) != tt.at {
+			t.Errorf("%s for %s: expected %v%% at %s, got %v%% at %s", tt.from, tt.window, tt.percent, tt.at, percent, at)
+		}
+	}
+	if _, at := forecast.MaxPrecipProbabilityFrom(from.Add(24*time.Hour), time.Hour); !at.IsZero() {
+		t.Errorf("expected no period after the forecast, got %s", at)
+	}
+	if _, at := forecast.MaxPrecipProbability(time.Hour); !at.IsZero() {
+		t.Errorf("expected the periods of the fixture to be in the past, got %s", at)
+	}
+}
+
+func TestNextChange(t *testing.T) {
+	useFixtures(t)
+	noaa.SetUnits("us")
+	forecast, err := noaa.HourlyForecast("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.HourlyForecast() should return the fixture: %v", err)
+	}
+	tests := []struct {
+		field     string
+		threshold float64
+		at        string
+		from, to  string
+	}{
+		{"shortForecast", 0, "2023-05-21T16:00:00-05:00", "Sunny", "Mostly Sunny"},
+		{"probabilityOfPrecipitation", 0, "2023-05-21T19:00:00-05:00", "35%", "60%"},
+		{"probabilityOfPrecipitation", 30, "2023-05-21T18:00:00-05:00", "15%", "35%"},
+	}
+	for _, tt := range tests {
+		noaa.SetPrecipThreshold(tt.threshold)
+		at, from, to, ok := forecast.NextChange(tt.field)
+		if !ok || at.Format(time.RFC3339) != tt.at || from != tt.from || to != tt.to {
+			t.Errorf("%s: expected %s to %s at %s, got %q to %q at %s (%v)", tt.field, tt.from, tt.to, tt.at, from, to, at, ok)
+		}
+	}
+	for _, field := range []string{"temperature", "windSpeed"} {
+		if _, _, _, ok := forecast.NextChange(field); ok {
+			t.Errorf("%s: expected no change", field)
+		}
+	}
+
+	freezing := noaa.HourlyForecastResponse{Periods: []noaa.ForecastResponsePeriodHourly{
+		{StartTime: "2023-01-10T01:00:00-06:00", Temperature: 34, TemperatureUnit: "F"},
+		{StartTime: "2023-01-10T02:00:00-06:00", Temperature: 33, TemperatureUnit: "F"},
+		{StartTime: "2023-01-10T03:00:00-06:00", Temperature: 32, TemperatureUnit: "F"},
+	}}
+	if at, from, to, ok := freezing.NextChange("temperature"); !ok || at.Hour() != 3 || from != "33°F" || to != "32°F" {
+		t.Errorf("expected 33°F to 32°F at 03:00, got %q to %q at %s (%v)", from, to, at, ok)
+	}
+}
+
+func TestBucket(t *testing.T) {
+	useFixtures(t)
+	noaa.SetUnits("us")
+	forecast, err := noaa.HourlyForecast("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.HourlyForecast() should return the fixture: %v", err)
+	}
+	buckets := forecast.Bucket(6 * time.Hour)
+	if len(buckets) != 2 {
+		t.Fatalf("expected the afternoon and evening buckets, got %d", len(buckets))
+	}
+	afternoon, evening := buckets[0], buckets[1]
+	if afternoon.StartTime != "2023-05-21T14:00:00-05:00" || evening.StartTime != "2023-05-21T18:00:00-05:00" {
+		t.Errorf("expected buckets at 14:00 and 18:00, got %s and %s", afternoon.StartTime, evening.StartTime)
+	}
+	if afternoon.Summary != "Sunny" || afternoon.QuantitativeProbability.Value != 15 || !afternoon.IsDaytime {
+		t.Errorf("expected a sunny afternoon with 15%%, got %q with %s", afternoon.Summary, afternoon.QuantitativeProbability)
+	}
+	if evening.Summary != "Chance Showers And Thunderstorms" || evening.QuantitativeProbability.Value != 60 {
+		t.Errorf("expected a chance of storms with 60%%, got %q with %s", evening.Summary, evening.QuantitativeProbability)
+	}
+	if evening.ID != 2 || evening.EndTime != "2023-05-21T22:00:00-05:00" {
+		t.Errorf("expected bucket 2 to end at 22:00, got %d ending %s", evening.ID, evening.EndTime)
+	}
+	if afternoon.Temperature != 73 || afternoon.TemperatureUnit != "F" {
+		t.Errorf("expected an average of 73°F, got %v°%s", afternoon.Temperature, afternoon.TemperatureUnit)
+	}
+	if buckets := forecast.Bucket(0); buckets != nil {
+		t.Errorf("expected no buckets for a zero size, got %d", len(buckets))
+	}
+}
+
+func TestBucketMissingTemperature(t *testing.T) {
+	hour := func(start string, temperature noaa.QuantitativeValue) noaa.ForecastResponsePeriodHourly {
+		return noaa.ForecastResponsePeriodHourly{
+			StartTime:               start,
+			EndTime:                 start,
+			Temperature:             temperature.Value,
+			TemperatureUnit:         "F",
+			QuantitativeTemperature: temperature,
+		}
+	}
+	forecast := noaa.HourlyForecastResponse{Periods: []noaa.ForecastResponsePeriodHourly{
+		hour("2023-05-21T14:00:00-05:00", noaa.NewQuantitativeValue(70, "wmoUnit:degF")),
+		hour("2023-05-21T15:00:00-05:00", noaa.QuantitativeValue{UnitCode: "wmoUnit:degF"}), // null value
+		hour("2023-05-21T16:00:00-05:00", noaa.NewQuantitativeValue(74, "wmoUnit:degF")),
+	}}
+	buckets := forecast.Bucket(24 * time.Hour)
+	if len(buckets) != 1 {
+		t.Fatalf("expected a single bucket, got %d", len(buckets))
+	}
+	if buckets[0].Temperature != 72 || buckets[0].QuantitativeTemperature.Value != 72 {
+		t.Errorf("expected the missing hour to be skipped for an average of 72°F, got %v and %s", buckets[0].Temperature, buckets[0].QuantitativeTemperature)
+	}
+}
+
+func TestAcceptFallback(t *testing.T) {
+	useFixtures(t)
+	var logs strings.Builder
+	noaa.SetLogger(log.New(&logs, "", 0))
+	noaa.SetAcceptHeader("application/geo+json")
+	for _, geo := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusNotAcceptable, `{"status": 406}`},
+		{http.StatusOK, "not json"},
+	} {
+		status, body := geo.status, geo.body
+		noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.Contains(req.Header.Get("Accept"), "geo+json") {
+				return fixtureResponse(req, status, []byte(body)), nil
+			}
+			return apiFixtures.RoundTrip(req)
+		}))
+		office, err := noaa.Office("LOT")
+		if err != nil || office.ID != "LOT" {
+			t.Fatalf("%d: noaa.Office() should fall back to JSON-LD: %v", status, err)
+		}
+	}
+	if !strings.Contains(logs.String(), "falling back to application/ld+json") {
+		t.Errorf("expected the fallback to be logged, got %q", logs.String())
+	}
+
+	noaa.SetAcceptFallback(false)
+	var apiErr *noaa.APIError
+	if _, err := noaa.Office("LOT"); err == nil {
+		t.Error("expected the decoding error without the fallback")
+	} else if errors.As(err, &apiErr) {
+		t.Errorf("expected the decoding error, got %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	useFixtures(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		res, err := apiFixtures.RoundTrip(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer res.Body.Close()
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	defer server.Close()
+	ignore := goleak.IgnoreCurrent()
+
+	noaa.SetBaseURL(server.URL)
+	noaa.SetClient(&http.Client{Transport: &http.Transport{}})
+	for i := 0; i < 2; i++ {
+		if _, err := noaa.Office("LOT"); err != nil {
+			t.Fatalf("noaa.Office() should return the fixture: %v", err)
+		}
+	}
+	noaa.Close()
+	goleak.VerifyNone(t, ignore)
+}
+
+func TestWeatherAt(t *testing.T) {
+	item := noaa.WeatherValueItem{Coverage: "likely", Weather: "rain_showers", Intensity: "moderate"}
+	if phrase := item.Describe(); phrase != "Likely moderate rain showers" {
+		t.Errorf("expected Likely moderate rain showers, got %q", phrase)
+	}
+	if phrase := (noaa.WeatherValueItem{Weather: "fog"}).Describe(); phrase != "Fog" {
+		t.Errorf("expected Fog, got %q", phrase)
+	}
+
+	gridpoint := noaa.GridpointForecastResponse{Weather: noaa.Weather{Values: []noaa.WeatherValue{
+		{ValidTime: "2023-05-21T18:00:00+00:00/PT3H", Value: []noaa.WeatherValueItem{{}}},
+		{ValidTime: "2023-05-21T21:00:00+00:00/PT6H", Value: []noaa.WeatherValueItem{
+			{Coverage: "chance", Weather: "rain_showers", Intensity: "light"},
+			{Coverage: "slight_chance", Weather: "thunderstorms"},
+		}},
+	}}}
+	if phrase := gridpoint.WeatherAt(time.Date(2023, 5, 21, 19, 0, 0, 0, time.UTC)); phrase != "" {
+		t.Errorf("expected no weather, got %q", phrase)
+	}
+	want := "Chance light rain showers and slight chance thunderstorms"
+	if phrase := gridpoint.WeatherAt(time.Date(2023, 5, 21, 22, 0, 0, 0, time.UTC)); phrase != want {
+		t.Errorf("expected %q, got %q", want, phrase)
+	}
+}
+
+// TestConcurrentSetClient runs the first request with the default (nil) client
+// concurrently with SetClient, which must not race under -race.
+func TestConcurrentSetClient(t *testing.T) {
+	useFixtures(t)
+	config := noaa.GetConfig()
+	config.Client = nil
+	noaa.SetConfig(config)
+	http.DefaultClient.Transport = apiFixtures
+	t.Cleanup(func() { http.DefaultClient.Transport = nil })
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		noaa.Office("LOT")
+	}()
+	go func() {
+		defer wg.Done()
+		noaa.SetClient(&http.Client{Transport: apiFixtures})
+	}()
+	wg.Wait()
+	if client := noaa.GetConfig().Client; client == http.DefaultClient {
+		t.Error("the request should not replace the configured client")
+	}
+}
+
+func TestConcurrentSetMaxPages(t *testing.T) {
+	useFixtures(t)
+	var wg sync.WaitGroup
+	for i := 1; i <= 4; i++ {
+		wg.Add(2)
+		go func(pages int) {
+			defer wg.Done()
+			noaa.SetMaxPages(pages)
+		}(i)
+		go func() {
+			defer wg.Done()
+			alerts, err := noaa.Alerts(noaa.AlertQuery{Area: []string{"IL"}})
+			if err != nil || len(alerts.Alerts) == 0 || len(alerts.Alerts) > 4 {
+				t.Errorf("expected 1 to 4 pages of alerts, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentSetLogger(t *testing.T) {
+	useFixtures(t)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		noaa.SetLogger(log.New(io.Discard, "", 0))
+	}()
+	go func() {
+		defer wg.Done()
+		var forecast noaa.GridpointForecastResponse
+		forecast.Select("unknown")
+	}()
+	wg.Wait()
+}
+
+func TestObservationsNearestTo(t *testing.T) {
+	useFixtures(t)
+	observations, err := noaa.Observations("KORD")
+	if err != nil {
+		t.Fatalf("noaa.Observations() should return the fixture: %v", err)
+	}
+	at := time.Date(2023, 5, 21, 8, 10, 0, 0, time.FixedZone("CDT", -5*60*60))
+	observation, ok := observations.NearestTo(at)
+	if !ok || observation.Timestamp != "2023-05-21T12:51:00+00:00" {
+		t.Errorf("expected the observation at 12:51Z, got %+v", observation)
+	}
+	if _, ok := (&noaa.ObservationsResponse{}).NearestTo(at); ok {
+		t.Error("expected no observation for an empty response")
+	}
+}
+
+// roundTripperFunc adapts a function to an http.RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSetRoundTripper(t *testing.T) {
+	useFixtures(t)
+	noaa.SetTimeout(5 * time.Second)
+	var requests int32
+	noaa.SetRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return apiFixtures.RoundTrip(req)
+	}))
+	if _, err := noaa.Office("LOT"); err != nil {
+		t.Fatalf("noaa.Office() should use the transport: %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request through the transport, got %d", n)
+	}
+	if client := noaa.GetConfig().Client.(*http.Client); client.Timeout != 5*time.Second {
+		t.Errorf("expected the timeout to be kept, got %v", client.Timeout)
+	}
+
+	var logs strings.Builder
+	noaa.SetLogger(log.New(&logs, "", 0))
+	noaa.SetClient(doerFunc(apiFixtures.RoundTrip))
+	noaa.SetRoundTripper(apiFixtures)
+	if _, ok := noaa.GetConfig().Client.(doerFunc); !ok || !strings.Contains(logs.String(), "can not set a transport") {
+		t.Errorf("expected a Doer to be kept with a warning, got %q", logs.String())
+	}
+}
+
+func TestPrecipTypeAt(t *testing.T) {
+	series := func(uom string, values ...float64) noaa.GridpointForecastTimeSeries {
+		s := noaa.GridpointForecastTimeSeries{Uom: uom}
+		for i, value := range values {
+			validTime := fmt.Sprintf("2023-01-10T%02d:00:00+00:00/PT1H", i)
+			s.Values = append(s.Values, noaa.GridpointForecastTimeSeriesValue{ValidTime: validTime, Value: value})
+		}
+		return s
+	}
+	gridpoint := noaa.GridpointForecastResponse{
+		Temperature:               series("wmoUnit:degC", 5, 5, -2, -1, 0, 3, -3),
+		QuantitativePrecipitation: series("wmoUnit:mm", 0, 2, 1, 1, 1, 2, 1),
+		SnowfallAmount:            series("wmoUnit:mm", 0, 0, 10, 5, 0, 8, 0),
+		IceAccumulation:           series("wmoUnit:mm", 0, 0, 0, 1, 0, 0, 0),
+		Weather: noaa.Weather{Values: []noaa.WeatherValue{
+			{ValidTime: "2023-01-10T06:00:00+00:00/PT1H", Value: []noaa.WeatherValueItem{{Coverage: "chance", Weather: "sleet"}}},
+		}},
+	}
+	for hour, want := range []string{"none", "rain", "snow", "mix", "freezing_rain", "mix", "sleet"} {
+		at := time.Date(2023, 1, 10, hour, 30, 0, 0, time.UTC)
+		if got := gridpoint.PrecipTypeAt(at); got != want {
+			t.Errorf("%02d:30: expected %s, got %s", hour, want, got)
+		}
+	}
+}
+
+func TestForecastDiscussion(t *testing.T) {
+	useFixtures(t)
+	text, err := noaa.ForecastDiscussion("41.837", "-87.685")
+	if err != nil {
+		t.Fatalf("noaa.ForecastDiscussion() should return the LOT discussion: %v", err)
+	}
+	if !strings.Contains(text, "AFDLOT") || !strings.Contains(text, "Sunny and warm today") {
+		t.Errorf("expected the latest discussion, got %q", text)
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	useFixtures(t)
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+		return apiFixtures.RoundTrip(req)
+	}))
+	noaa.SetDefaultTimeout(20 * time.Millisecond)
+	if _, err := noaa.Office("LOT"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the default timeout to be exceeded, got %v", err)
+	}
+	// explicit contexts ignore the default
+	if _, err := noaa.StationsContext(context.Background(), "41.837", "-87.685"); err != nil {
+		t.Errorf("noaa.StationsContext() should ignore the default timeout: %v", err)
+	}
+	noaa.SetDefaultTimeout(0)
+	if _, err := noaa.Office("LOT"); err != nil {
+		t.Errorf("noaa.Office() should succeed without a default timeout: %v", err)
+	}
+}
+
+// testGridpoint returns a gridpoint forecast with series of intervals of
+// different lengths.
+func testGridpoint() *noaa.GridpointForecastResponse {
+	return &noaa.GridpointForecastResponse{
+		Updated: "2023-05-21T14:00:00+00:00",
+		Temperature: noaa.GridpointForecastTimeSeries{Uom: "wmoUnit:degC", Values: []noaa.GridpointForecastTimeSeriesValue{
+			{ValidTime: "2023-05-21T14:00:00+00:00/PT1H", Value: 21.1},
+			{ValidTime: "2023-05-21T15:00:00+00:00/PT2H", Value: 22.2},
+		}},
+		ProbabilityOfPrecipitation: noaa.GridpointForecastTimeSeries{Uom: "wmoUnit:percent", Values: []noaa.GridpointForecastTimeSeriesValue{
+			{ValidTime: "2023-05-21T14:00:00+00:00/PT3H", Value: 20},
+		}},
+		QuantitativePrecipitation: noaa.GridpointForecastTimeSeries{Uom: "wmoUnit:mm", Values: []noaa.GridpointForecastTimeSeriesValue{
+			{ValidTime: "2023-05-21T16:00:00+00:00/PT2H", Value: 2.5},
+		}},
+		Weather: noaa.Weather{Values: []noaa.WeatherValue{
+			{ValidTime: "2023-05-21T16:00:00+00:00/PT2H", Value: []noaa.WeatherValueItem{{Coverage: "chance", Weather: "rain_showers"}}},
+		}},
+	}
+}
+
+func TestGridpointSelect(t *testing.T) {
+	useFixtures(t)
+	var logs strings.Builder
+	noaa.SetLogger(log.New(&logs, "", 0))
+	gridpoint := testGridpoint()
+
+	selected := gridpoint.Select("temperature", "weather", "windGusts")
+	if len(selected.Temperature.Values) != 2 || selected.Temperature.Uom != "wmoUnit:degC" || len(selected.Weather.Values) != 1 {
+		t.Errorf("expected the selected series to stay populated, got %+v", selected)
+	}
+	if len(selected.ProbabilityOfPrecipitation.Values) != 0 || len(selected.QuantitativePrecipitation.Values) != 0 {
+		t.Errorf("expected the other series to be dropped, got %+v", selected)
+	}
+	if selected.Updated != gridpoint.Updated {
+		t.Errorf("expected the other fields to be kept, got %q", selected.Updated)
+	}
+	if !reflect.DeepEqual(gridpoint, testGridpoint()) {
+		t.Errorf("expected the original forecast to be untouched, got %+v", gridpoint)
+	}
+	if !strings.Contains(logs.String(), `"windGusts"`) {
+		t.Errorf("expected a warning for the unknown parameter, got %q", logs.String())
+	}
+}
+
+func TestGridpointToTable(t *testing.T) {
+	rows := testGridpoint().ToTable(0)
+	want := []map[string]float64{
+		{"temperature": 21.1, "probabilityOfPrecipitation": 20},
+		{"temperature": 22.2, "probabilityOfPrecipitation": 20},
+		{"temperature": 22.2, "probabilityOfPrecipitation": 20, "quantitativePrecipitation": 2.5},
+		{"quantitativePrecipitation": 2.5},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d hourly rows from 14:00 to 18:00, got %d", len(want), len(rows))
+	}
+	start := time.Date(2023, 5, 21, 14, 0, 0, 0, time.UTC)
+	for i, row := range rows {
+		if !row.Time.Equal(start.Add(time.Duration(i)*time.Hour)) || !reflect.DeepEqual(row.Values, want[i]) {
+			t.Errorf("row %d: expected %v at %s, got %v at %s", i, want[i], start.Add(time.Duration(i)*time.Hour), row.Values, row.Time)
+		}
+	}
+
+	rows = testGridpoint().ToTable(2 * time.Hour)
+	if len(rows) != 2 || !rows[1].Time.Equal(start.Add(2*time.Hour)) || rows[1].Values["quantitativePrecipitation"] != 2.5 {
+		t.Errorf("expected 2 rows at 14:00 and 16:00, got %+v", rows)
+	}
+	if rows := (&noaa.GridpointForecastResponse{}).ToTable(time.Hour); rows != nil {
+		t.Errorf("expected no rows without series, got %+v", rows)
+	}
+}
+
+func TestWriteForecastCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := noaa.WriteForecastCSV(&buf, testGridpoint(), nil); err != nil {
+		t.Fatalf("noaa.WriteForecastCSV() returned an error: %v", err)
+	}
+	golden, err := os.ReadFile(filepath.Join("testdata", "forecast_gridpoint.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(golden) {
+		t.Errorf("expected the golden CSV:\n%s\ngot:\n%s", golden, buf.String())
+	}
+	if err := noaa.WriteForecastCSV(&buf, testGridpoint(), []string{"temperature", "unknown"}); err == nil {
+		t.Error("expected an error for an unknown parameter")
+	}
+}
+
+func TestFollowRedirects(t *testing.T) {
+	useFixtures(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/offices/LOT" {
+			http.Redirect(w, req, "/offices/MOVED", http.StatusMovedPermanently)
+			return
+		}
+		http.NotFound(w, req)
+	}))
+	defer server.Close()
+	noaa.SetBaseURL(server.URL)
+	noaa.SetClient(server.Client())
+
+	var apiErr *noaa.APIError
+	if _, err := noaa.Office("LOT"); !errors.As(err, &apiErr) {
+		t.Fatalf("expected an *APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the redirect to be followed to a 404, got %d", apiErr.StatusCode)
+	}
+	if apiErr.URL != server.URL+"/offices/LOT" || apiErr.FinalURL != server.URL+"/offices/MOVED" {
+		t.Errorf("expected the redirect in URL and FinalURL, got %q and %q", apiErr.URL, apiErr.FinalURL)
+	}
+	if apiErr.Location != "" {
+		t.Errorf("expected no Location for a followed redirect, got %q", apiErr.Location)
+	}
+
+	noaa.SetFollowRedirects(false)
+	if _, err := noaa.Office("LOT"); !errors.As(err, &apiErr) {
+		t.Fatalf("expected an *APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("expected the redirect to be returned, got %d", apiErr.StatusCode)
+	}
+	if apiErr.FinalURL != apiErr.URL {
+		t.Errorf("expected FinalURL to be the requested URL %q, got %q", apiErr.URL, apiErr.FinalURL)
+	}
+	if apiErr.Location != "/offices/MOVED" {
+		t.Errorf("expected the Location of the redirect, got %q", apiErr.Location)
+	}
+	if !strings.Contains(apiErr.Error(), "not followed") {
+		t.Errorf("expected the error to mention the redirect, got %q", apiErr.Error())
+	}
+}
+
+// fixedSource is a rand.Source that always returns the same value, so that
+// rand.Int63n(n) returns value for every n greater than value.
+type fixedSource int64
+
+func (s fixedSource) Int63() int64 { return int64(s) }
+func (fixedSource) Seed(int64)     {}
+
+func TestSetJitterSource(t *testing.T) {
+	useFixtures(t)
+	t.Cleanup(func() { noaa.SetJitterSource(rand.NewSource(time.Now().UnixNano())) })
+	const jitter = 20 * time.Millisecond
+	var mu sync.Mutex
+	var requests []time.Time
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, time.Now())
+		return fixtureResponse(req, http.StatusServiceUnavailable, nil), nil
+	}))
+	// without the jitter source the second retry would wait for two hours
+	noaa.SetRetries(2, time.Hour)
+	noaa.SetRetryJitter(true)
+	noaa.SetJitterSource(fixedSource(jitter))
+
+	start := time.Now()
+	if _, err := noaa.Office("LOT"); err == nil {
+		t.Fatal("expected the last 503 to be returned")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the retries to use the jitter source, took %v", elapsed)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(requests))
+	}
+	for i := 1; i < len(requests); i++ {
+		if delay := requests[i].Sub(requests[i-1]); delay < jitter {
+			t.Errorf("expected retry %d to wait at least %v, waited %v", i, jitter, delay)
+		}
+	}
+}
+
+func TestClearCachesOnBaseURL(t *testing.T) {
+	useFixtures(t)
+	var points, stations int32
+	noaa.SetClient(doerFunc(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case strings.HasPrefix(req.URL.Path, "/points/"):
+			atomic.AddInt32(&points, 1)
+		case strings.HasSuffix(req.URL.Path, "/stations"):
+			atomic.AddInt32(&stations, 1)
+		}
+		return apiFixtures.RoundTrip(req)
+	}))
+	observe := func() (int32, int32) {
+		t.Helper()
+		if _, err := noaa.ObservationForPoint("41.837", "-87.685", "KORD"); err != nil {
+			t.Fatalf("noaa.ObservationForPoint() should return the fixture: %v", err)
+		}
+		return atomic.LoadInt32(&points), atomic.LoadInt32(&stations)
+	}
+
+	observe()
+	// the point may have been cached by another test
+	if points, stations := observe(); points > 1 || stations > 1 {
+		t.Fatalf("expected the point and stations to be cached, got %d and %d requests", points, stations)
+	}
+	atomic.StoreInt32(&points, 0)
+	atomic.StoreInt32(&stations, 0)
+
+	noaa.SetBaseURL("https://example.com")
+	noaa.SetBaseURL(noaa.API)
+	if points, stations := observe(); points != 1 || stations != 1 {
+		t.Errorf("expected SetBaseURL to clear the caches, got %d and %d requests", points, stations)
+	}
+
+	noaa.SetPathPrefix("/v2")
+	noaa.SetPathPrefix("")
+	if points, stations := observe(); points != 2 || stations != 2 {
+		t.Errorf("expected SetPathPrefix to clear the caches, got %d and %d requests", points, stations)
+	}
+}
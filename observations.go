@@ -0,0 +1,120 @@
+package noaa
+
+import (
+	"math"
+	"time"
+)
+
+// METAR returns the raw METAR (or SPECI) report the observation was decoded
+// from, e.g. "KORD 211451Z 22009KT 10SM FEW250 22/10 A3012". It is empty for
+// stations that do not report METARs.
+func (o Observation) METAR() string {
+	return o.RawMessage
+}
+
+// InUnits returns a copy of the observation with its temperature, wind,
+// pressure, visibility, and precipitation values converted to "us" or "si"
+// units, or their "imperial" and "metric" aliases. Observations are returned by
+// the API in the station's units (usually metric) regardless of SetUnits, so a
+// blank units value converts to the configured units. ErrInvalidUnits is
+// returned for any other value.
+func (o *Observation) InUnits(units string) (*Observation, error) {
+	units, err := parseUnits(units)
+	if err != nil {
+		return nil, err
+	}
+	if units == "" {
+		units = snapshotConfig().Units
+	}
+	temperature, speed, pressure, distance, precipitation := unitDegF, unitMph, unitInHg, unitMi, unitIn
+	if units == "si" {
+		temperature, speed, pressure, distance, precipitation = unitDegC, unitKmh, unitPa, unitM, unitMm
+	}
+	c := *o
+	c.Temperature = convert(o.Temperature, temperature)
+	c.Dewpoint = convert(o.Dewpoint, temperature)
+	c.WindChill = convert(o.WindChill, temperature)
+	c.HeatIndex = convert(o.HeatIndex, temperature)
+	c.WindSpeed = convert(o.WindSpeed, speed)
+	c.WindGust = convert(o.WindGust, speed)
+	c.BarometricPressure = convert(o.BarometricPressure, pressure)
+	c.SeaLevelPressure = convert(o.SeaLevelPressure, pressure)
+	c.Visibility = convert(o.Visibility, distance)
+	c.PrecipitationLastHour = convert(o.PrecipitationLastHour, precipitation)
+	return &c, nil
+}
+
+// steadyTrend is the change per hour under which a trend is considered steady.
+const steadyTrend = 0.1
+
+// NearestTo returns the observation whose Timestamp is closest to t, e.g. to
+// correlate an event with the conditions at that time. Observations without a
+// valid timestamp are skipped. False is returned if there are none.
+func (r *ObservationsResponse) NearestTo(t time.Time) (*Observation, bool) {
+	var nearest *Observation
+	var nearestDistance time.Duration
+	for i := range r.Observations {
+		timestamp, err := time.Parse(time.RFC3339, r.Observations[i].Timestamp)
+		if err != nil {
+			continue
+		}
+		distance := timestamp.Sub(t)
+		if distance < 0 {
+			distance = -distance
+		}
+		if nearest == nil || distance < nearestDistance {
+			nearest, nearestDistance = &r.Observations[i], distance
+		}
+	}
+	return nearest, nearest != nil
+}
+
+// TemperatureTrend computes a linear trend of the temperatures over the time
+// span of the observations and returns "rising", "falling", or "steady" along
+// with the change per hour in the unit of the observations (usually °C).
+// Observations without a temperature or timestamp are skipped. An empty
+// string is returned when there are fewer than two usable observations.
+func (r *ObservationsResponse) TemperatureTrend() (risingOrFalling string, deltaPerHour float64) {
+	var xs, ys []float64
+	for _, observation := range r.Observations {
+		if !observation.Temperature.HasValue() {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339, observation.Timestamp)
+		if err != nil {
+			continue
+		}
+		xs = append(xs, float64(timestamp.Unix())/3600)
+		ys = append(ys, observation.Temperature.Value)
+	}
+	if len(xs) < 2 {
+		return "", 0
+	}
+
+	// least squares slope of temperature over hours
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+	var num, den float64
+	for i := range xs {
+		num += (xs[i] - meanX) * (ys[i] - meanY)
+		den += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if den == 0 {
+		return "", 0
+	}
+
+	deltaPerHour = num / den
+	switch {
+	case math.Abs(deltaPerHour) < steadyTrend:
+		return "steady", deltaPerHour
+	case deltaPerHour > 0:
+		return "rising", deltaPerHour
+	default:
+		return "falling", deltaPerHour
+	}
+}
@@ -0,0 +1,62 @@
+package noaa
+
+import (
+	"strings"
+	"sync"
+)
+
+// OfficeIDs are the identifiers of the 122 NWS Weather Forecast Offices (WFO)
+// which can be passed to Office or Offices.
+var OfficeIDs = []string{
+	"ABQ", "ABR", "AFC", "AFG", "AJK", "AKQ", "ALY", "AMA", "APX", "ARX",
+	"BGM", "BIS", "BMX", "BOI", "BOU", "BOX", "BRO", "BTV", "BUF", "BYZ",
+	"CAE", "CAR", "CHS", "CLE", "CRP", "CTP", "CYS", "DDC", "DLH", "DMX",
+	"DTX", "DVN", "EAX", "EKA", "EPZ", "EWX", "FFC", "FGF", "FGZ", "FSD",
+	"FWD", "GGW", "GID", "GJT", "GLD", "GRB", "GRR", "GSP", "GUM", "GYX",
+	"HFO", "HGX", "HNX", "HUN", "ICT", "ILM", "ILN", "ILX", "IND", "IWX",
+	"JAN", "JAX", "JKL", "KEY", "LBF", "LCH", "LIX", "LKN", "LMK", "LOT",
+	"LOX", "LSX", "LUB", "LWX", "LZK", "MAF", "MEG", "MFL", "MFR", "MHX",
+	"MKX", "MLB", "MOB", "MPX", "MQT", "MRX", "MSO", "MTR", "OAX", "OHX",
+	"OKX", "OTX", "OUN", "PAH", "PBZ", "PDT", "PHI", "PIH", "PQR", "PSR",
+	"PUB", "RAH", "REV", "RIW", "RLX", "RNK", "SEW", "SGF", "SGX", "SHV",
+	"SJT", "SJU", "SLC", "STO", "TAE", "TBW", "TFX", "TOP", "TSA", "TWC",
+	"UNR", "VEF",
+}
+
+// maxConcurrentOffices limits the number of concurrent requests made by Offices.
+const maxConcurrentOffices = 8
+
+// Offices returns the details of several forecast offices keyed by ID, fetched
+// concurrently. For example, Offices(OfficeIDs...) returns every office. If any
+// request fails the offices fetched successfully are returned along with the
+// first error. Like ForecastBatch, a snapshot of the config is used for every
+// request.
+func Offices(ids ...string) (offices map[string]*OfficeResponse, err error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	offices = make(map[string]*OfficeResponse, len(ids))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, maxConcurrentOffices)
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			office, officeErr := officeContext(ctx, id)
+			mu.Lock()
+			defer mu.Unlock()
+			if officeErr != nil {
+				if err == nil {
+					err = officeErr
+				}
+				return
+			}
+			offices[id] = office
+		}(strings.ToUpper(id))
+	}
+	wg.Wait()
+	return offices, err
+}
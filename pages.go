@@ -0,0 +1,115 @@
+package noaa
+
+import "context"
+
+// page is a paginated response that can be combined with its next page, see
+// decodePages.
+type page[T any] interface {
+	*T
+	cursor() string // the URL of the next page, blank on the last page
+	size() int      // the number of items on the page
+	combine(next *T)
+}
+
+// decodePages decodes the response of endpoint and follows its pagination
+// cursor for up to Config.MaxPages pages in total, or defaultPages if MaxPages
+// is not set, combining every page into the first one. Zero defaultPages
+// follows the cursor until the last page, which is also assumed once a page has
+// no items or, when no cap applies, links back to itself. See SetMaxPages.
+func decodePages[T any, P page[T]](ctx context.Context, endpoint string, defaultPages int) (*T, error) {
+	var first P
+	if err := decode(ctx, endpoint, &first); err != nil {
+		return nil, err
+	}
+	maxPages := configFrom(ctx).MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultPages
+	}
+	for pages := 1; (maxPages <= 0 || pages < maxPages) && first.cursor() != ""; pages++ {
+		cursor := first.cursor()
+		var next P
+		if err := decode(ctx, cursor, &next); err != nil {
+			return nil, err
+		}
+		first.combine(next)
+		if next.size() == 0 || (maxPages <= 0 && next.cursor() == cursor) {
+			break
+		}
+	}
+	return first, nil
+}
+
+// nextPage decodes the page at the pagination cursor of r. A nil page and nil
+// error are returned when r is the last page.
+func nextPage[T any, P page[T]](r P) (*T, error) {
+	if r.cursor() == "" {
+		return nil, nil
+	}
+	ctx, cancel := defaultContext()
+	defer cancel()
+	var next P
+	if err := decode(ctx, r.cursor(), &next); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// NextPage follows the pagination cursor of the response and returns the next
+// page of alerts. A nil response and nil error are returned when there are no
+// more pages.
+func (r *AlertsResponse) NextPage() (*AlertsResponse, error) {
+	return nextPage[AlertsResponse](r)
+}
+
+func (r *AlertsResponse) cursor() string { return r.Pagination.Next }
+func (r *AlertsResponse) size() int      { return len(r.Alerts) }
+
+func (r *AlertsResponse) combine(next *AlertsResponse) {
+	r.Alerts = append(r.Alerts, next.Alerts...)
+	r.Pagination = next.Pagination
+}
+
+// NextPage follows the pagination cursor of the response and returns the next
+// page of stations. A nil response and nil error are returned when there are no
+// more pages.
+func (r *StationsListResponse) NextPage() (*StationsListResponse, error) {
+	return nextPage[StationsListResponse](r)
+}
+
+func (r *StationsListResponse) cursor() string { return r.Pagination.Next }
+func (r *StationsListResponse) size() int      { return len(r.Stations) }
+
+func (r *StationsListResponse) combine(next *StationsListResponse) {
+	r.Stations = append(r.Stations, next.Stations...)
+	r.Pagination = next.Pagination
+}
+
+// NextPage follows the pagination cursor of the response and returns the next
+// page of SIGMETs. A nil response and nil error are returned when there are no
+// more pages.
+func (r *SIGMETsResponse) NextPage() (*SIGMETsResponse, error) {
+	return nextPage[SIGMETsResponse](r)
+}
+
+func (r *SIGMETsResponse) cursor() string { return r.Pagination.Next }
+func (r *SIGMETsResponse) size() int      { return len(r.SIGMETs) }
+
+func (r *SIGMETsResponse) combine(next *SIGMETsResponse) {
+	r.SIGMETs = append(r.SIGMETs, next.SIGMETs...)
+	r.Pagination = next.Pagination
+}
+
+// NextPage follows the pagination cursor of the response and returns the next
+// page of observations. A nil response and nil error are returned when there
+// are no more pages.
+func (r *ObservationsResponse) NextPage() (*ObservationsResponse, error) {
+	return nextPage[ObservationsResponse](r)
+}
+
+func (r *ObservationsResponse) cursor() string { return r.Pagination.Next }
+func (r *ObservationsResponse) size() int      { return len(r.Observations) }
+
+func (r *ObservationsResponse) combine(next *ObservationsResponse) {
+	r.Observations = append(r.Observations, next.Observations...)
+	r.Pagination = next.Pagination
+}
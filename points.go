@@ -0,0 +1,65 @@
+package noaa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Location returns the IANA timezone of the point, e.g. America/Chicago, as a
+// *time.Location for use in time calculations and for displaying forecast
+// times in local time. Loading the location requires the timezone database to
+// be available on the host (or embedded with the time/tzdata package).
+func (p *PointsResponse) Location() (*time.Location, error) {
+	if p.Timezone == "" {
+		return nil, errors.New("point has no timezone")
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("loading timezone %q (is the timezone database installed?): %w", p.Timezone, err)
+	}
+	return loc, nil
+}
+
+// GridID returns the grid identifier of the point in the same format used by
+// the gridpoint endpoints, for example "LOT/74,71".
+func (p *PointsResponse) GridID() string {
+	return fmt.Sprintf("%s/%d,%d", p.CWA, p.GridX, p.GridY)
+}
+
+// String returns a short description of the point useful for debugging.
+func (p *PointsResponse) String() string {
+	return fmt.Sprintf("%s (grid %s, %s)", p.ID, p.GridID(), p.Timezone)
+}
+
+// IsOutsideUS reports whether err is the 404 returned by a points lookup for a
+// location outside of the areas covered by the API, such as a location outside
+// of the U.S. territories or a blank or zero lat, lon.
+func IsOutsideUS(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) &&
+		apiErr.StatusCode == http.StatusNotFound &&
+		strings.Contains(apiErr.URL, "/points/")
+}
+
+// ErrInvalidCoordinates is returned by point lookups for a blank or zero lat,
+// lon when Config.StrictCoordinates is enabled. See SetStrictCoordinates.
+var ErrInvalidCoordinates = errors.New("invalid coordinates")
+
+// checkCoordinates returns ErrInvalidCoordinates if lat or lon is blank or if
+// both are zero. Other values are left for the API to validate.
+func checkCoordinates(lat string, lon string) error {
+	lat, lon = strings.TrimSpace(lat), strings.TrimSpace(lon)
+	if lat == "" || lon == "" {
+		return fmt.Errorf("%w: blank lat, lon %q,%q", ErrInvalidCoordinates, lat, lon)
+	}
+	latitude, latErr := strconv.ParseFloat(lat, 64)
+	longitude, lonErr := strconv.ParseFloat(lon, 64)
+	if latErr == nil && lonErr == nil && latitude == 0 && longitude == 0 {
+		return fmt.Errorf("%w: zero lat, lon %s,%s", ErrInvalidCoordinates, lat, lon)
+	}
+	return nil
+}
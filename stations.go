@@ -0,0 +1,35 @@
+package noaa
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// earthRadius is the mean radius of the Earth in kilometers.
+const earthRadius = 6371.0088
+
+// Coordinates returns the latitude and longitude of the station parsed from its
+// WKT geometry, e.g. POINT(-87.93444 41.96019). Note that WKT lists the
+// longitude first.
+func (s StationResponse) Coordinates() (lat float64, lon float64, err error) {
+	wkt := strings.TrimSpace(s.Geometry)
+	if !strings.HasPrefix(wkt, "POINT(") || !strings.HasSuffix(wkt, ")") {
+		return 0, 0, fmt.Errorf("station has no point geometry: %q", s.Geometry)
+	}
+	if _, err = fmt.Sscanf(wkt[len("POINT("):len(wkt)-1], "%g %g", &lon, &lat); err != nil {
+		return 0, 0, fmt.Errorf("invalid station geometry %q: %w", s.Geometry, err)
+	}
+	return lat, lon, nil
+}
+
+// greatCircleDistance returns the haversine distance in kilometers between two
+// points given in degrees.
+func greatCircleDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := math.Pi / 180
+	dLat := (lat2 - lat1) * toRadians
+	dLon := (lon2 - lon1) * toRadians
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRadians)*math.Cos(lat2*toRadians)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
@@ -1,5 +1,11 @@
 package noaa
 
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
 // QuantitativeValue is available for various statistics and can be
 // enabled with an optional request header to the noaa API. In the
 // future it is expected at that QV will replace single values such
@@ -10,21 +16,121 @@ type QuantitativeValue struct {
 	MinValue       float64 `json:"minValue"`
 	UnitCode       string  `json:"unitCode"`
 	QualityControl string  `json:"qualityControl"`
+
+	present uint8 // the fields returned by the API, see HasValue
+}
+
+// Bits of QuantitativeValue.present.
+const (
+	hasValue uint8 = 1 << iota
+	hasMinValue
+	hasMaxValue
+)
+
+// NewQuantitativeValue returns a quantitative value that has a value, see
+// HasValue, even if value is 0, e.g. NewQuantitativeValue(0, "wmoUnit:degC").
+func NewQuantitativeValue(value float64, unitCode string) QuantitativeValue {
+	return QuantitativeValue{Value: value, UnitCode: unitCode, present: hasValue}
+}
+
+// has reports whether the field with the given bit and value is present, that
+// is returned by the API or non-zero.
+func (q QuantitativeValue) has(bit uint8, value float64) bool {
+	return q.present&bit != 0 || value != 0
+}
+
+// HasValue reports whether the API returned a value (or a min/max range) for
+// the quantitative value. The API returns null for missing data, such as
+// "windGust", which would otherwise be indistinguishable from an actual 0.
+// Values built in Go have a value if any of Value, MinValue, or MaxValue is
+// non-zero; use NewQuantitativeValue for a value of 0.
+func (q QuantitativeValue) HasValue() bool {
+	return q.has(hasValue, q.Value) || q.has(hasMinValue, q.MinValue) || q.has(hasMaxValue, q.MaxValue)
+}
+
+// UnmarshalJSON decodes a quantitative value and records whether any of its
+// values were present, see HasValue. A bare number (or numeric string) is also
+// accepted as the value, without a unit, in case the API changes the shape of
+// a field. Any previous contents of q are discarded, so null decodes into a
+// value without a value.
+func (q *QuantitativeValue) UnmarshalJSON(data []byte) error {
+	*q = QuantitativeValue{}
+	if value, ok, err := bareNumber(data); ok || err != nil {
+		if ok {
+			q.Value, q.present = value, hasValue
+		}
+		return err
+	}
+	type quantitativeValue QuantitativeValue
+	aux := struct {
+		*quantitativeValue
+		Value    *float64 `json:"value"`
+		MaxValue *float64 `json:"maxValue"`
+		MinValue *float64 `json:"minValue"`
+	}{quantitativeValue: (*quantitativeValue)(q)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Value != nil {
+		q.Value, q.present = *aux.Value, q.present|hasValue
+	}
+	if aux.MaxValue != nil {
+		q.MaxValue, q.present = *aux.MaxValue, q.present|hasMaxValue
+	}
+	if aux.MinValue != nil {
+		q.MinValue, q.present = *aux.MinValue, q.present|hasMinValue
+	}
+	return nil
+}
+
+// bareNumber decodes data if it is a JSON number or a string containing one.
+// False is returned for any other JSON value, such as an object or null.
+func bareNumber(data []byte) (value float64, ok bool, err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return 0, false, nil
+	}
+	switch c := data[0]; {
+	case c == '-' || (c >= '0' && c <= '9'):
+		err = json.Unmarshal(data, &value)
+	case c == '"':
+		var s string
+		if err = json.Unmarshal(data, &s); err == nil {
+			value, err = strconv.ParseFloat(s, 64)
+		}
+	default:
+		return 0, false, nil
+	}
+	return value, err == nil, err
 }
 
 // PointsResponse holds the JSON values from /points/<lat,lon>
 type PointsResponse struct {
-	ID                          string `json:"@id"`
-	CWA                         string `json:"cwa"`
-	Office                      string `json:"forecastOffice"`
-	GridX                       int64  `json:"gridX"`
-	GridY                       int64  `json:"gridY"`
-	EndpointForecast            string `json:"forecast"`
-	EndpointForecastHourly      string `json:"forecastHourly"`
-	EndpointObservationStations string `json:"observationStations"`
-	EndpointForecastGridData    string `json:"forecastGridData"`
-	Timezone                    string `json:"timeZone"`
-	RadarStation                string `json:"radarStation"`
+	Context                     json.RawMessage  `json:"@context,omitempty"` // JSON-LD context of the response
+	ID                          string           `json:"@id"`
+	CWA                         string           `json:"cwa"`
+	Office                      string           `json:"forecastOffice"`
+	GridX                       int64            `json:"gridX"`
+	GridY                       int64            `json:"gridY"`
+	EndpointForecast            string           `json:"forecast"`
+	EndpointForecastHourly      string           `json:"forecastHourly"`
+	EndpointObservationStations string           `json:"observationStations"`
+	EndpointForecastGridData    string           `json:"forecastGridData"`
+	EndpointForecastZone        string           `json:"forecastZone"`
+	EndpointCounty              string           `json:"county"`
+	EndpointFireWeatherZone     string           `json:"fireWeatherZone"`
+	Timezone                    string           `json:"timeZone"`
+	RadarStation                string           `json:"radarStation"`
+	RelativeLocation            RelativeLocation `json:"relativeLocation"`
+}
+
+// RelativeLocation holds the JSON values for the city nearest to a point and
+// the distance and bearing from that city to the point.
+type RelativeLocation struct {
+	City     string            `json:"city"`
+	State    string            `json:"state"`
+	Distance QuantitativeValue `json:"distance"`
+	Bearing  QuantitativeValue `json:"bearing"` // degrees from the city to the point
 }
 
 // OfficeAddress holds the JSON values for the address of an OfficeResponse
@@ -38,26 +144,219 @@ type OfficeAddress struct {
 
 // OfficeResponse holds the JSON values from /offices/<id>
 type OfficeResponse struct {
-	Type                        string        `json:"@type"`
-	URI                         string        `json:"@id"`
-	ID                          string        `json:"id"`
-	Name                        string        `json:"name"`
-	Address                     OfficeAddress `json:"address"`
-	Telephone                   string        `json:"telephone"`
-	FaxNumber                   string        `json:"faxNumber"`
-	Email                       string        `json:"email"`
-	SameAs                      string        `json:"sameAs"`
-	NWSRegion                   string        `json:"nwsRegion"`
-	ParentOrganization          string        `json:"parentOrganization"`
-	ResponsibleCounties         []string      `json:"responsibleCounties"`
-	ResponsibleForecastZones    []string      `json:"responsibleForecastZones"`
-	ResponsibleFireZones        []string      `json:"responsibleFireZones"`
-	ApprovedObservationStations []string      `json:"approvedObservationStations"`
+	Context                     json.RawMessage `json:"@context,omitempty"` // JSON-LD context of the response
+	Type                        string          `json:"@type"`
+	URI                         string          `json:"@id"`
+	ID                          string          `json:"id"`
+	Name                        string          `json:"name"`
+	Address                     OfficeAddress   `json:"address"`
+	Telephone                   string          `json:"telephone"`
+	FaxNumber                   string          `json:"faxNumber"`
+	Email                       string          `json:"email"`
+	SameAs                      string          `json:"sameAs"`
+	NWSRegion                   string          `json:"nwsRegion"`
+	ParentOrganization          string          `json:"parentOrganization"`
+	ResponsibleCounties         []string        `json:"responsibleCounties"`
+	ResponsibleForecastZones    []string        `json:"responsibleForecastZones"`
+	ResponsibleFireZones        []string        `json:"responsibleFireZones"`
+	ApprovedObservationStations []string        `json:"approvedObservationStations"`
+}
+
+// CWSUResponse holds the JSON values from /aviation/cwsus/<id>
+type CWSUResponse struct {
+	Context   json.RawMessage `json:"@context,omitempty"` // JSON-LD context of the response
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Street    string          `json:"street"`
+	City      string          `json:"city"`
+	State     string          `json:"state"`
+	ZipCode   string          `json:"zipCode"`
+	Email     string          `json:"email"`
+	Fax       string          `json:"fax"`
+	Phone     string          `json:"phone"`
+	URL       string          `json:"url"`
+	NWSRegion string          `json:"nwsRegion"`
+}
+
+// CenterWeatherAdvisory holds the JSON values for a Center Weather Advisory
+// (CWA) issued by a Center Weather Service Unit.
+type CenterWeatherAdvisory struct {
+	ID               string `json:"id"`
+	IssueTime        string `json:"issueTime"`
+	CWSU             string `json:"cwsu"`
+	Sequence         int    `json:"sequence"`
+	Start            string `json:"start"`
+	End              string `json:"end"`
+	ObservedProperty string `json:"observedProperty"`
+	Text             string `json:"text"`
+}
+
+// CWAsResponse holds the JSON values from /aviation/cwsus/<id>/cwas
+type CWAsResponse struct {
+	Context    json.RawMessage         `json:"@context,omitempty"` // JSON-LD context of the response
+	Advisories []CenterWeatherAdvisory `json:"@graph"`
+}
+
+// SIGMET holds the JSON values for a significant meteorological information
+// (SIGMET) advisory for aviation.
+type SIGMET struct {
+	ID         string `json:"id"`
+	IssueTime  string `json:"issueTime"`
+	FIR        string `json:"fir"`  // flight information region
+	ATSU       string `json:"atsu"` // air traffic service unit, e.g. KKCI
+	Sequence   string `json:"sequence"`
+	Phenomenon string `json:"phenomenon"`
+	Start      string `json:"start"`
+	ExpireTime string `json:"end"`
+	Area       string `json:"geometry"` // WKT polygon of the affected area, if any
+}
+
+// SIGMETsResponse holds the JSON values from /aviation/sigmets
+type SIGMETsResponse struct {
+	Context    json.RawMessage `json:"@context,omitempty"` // JSON-LD context of the response
+	SIGMETs    []SIGMET        `json:"@graph"`
+	Pagination Pagination      `json:"pagination"`
+}
+
+// Product holds the JSON values from /products/<id>, a text product issued
+// by an office such as an Area Forecast Discussion (AFD). ProductText is only
+// included when a single product is requested.
+type Product struct {
+	Context         json.RawMessage `json:"@context,omitempty"` // JSON-LD context of the response
+	URI             string          `json:"@id"`
+	ID              string          `json:"id"`
+	WMOCollectiveID string          `json:"wmoCollectiveId"`
+	IssuingOffice   string          `json:"issuingOffice"`
+	IssuanceTime    string          `json:"issuanceTime"`
+	ProductCode     string          `json:"productCode"`
+	ProductName     string          `json:"productName"`
+	ProductText     string          `json:"productText"`
+}
+
+// ProductsResponse holds the JSON values from /products/types/<code>/locations/<id>
+type ProductsResponse struct {
+	Context  json.RawMessage `json:"@context,omitempty"` // JSON-LD context of the response
+	Products []Product       `json:"@graph"`             // newest first
+}
+
+// AlertsCount holds the JSON values from /alerts/active/count
+type AlertsCount struct {
+	Total   int            `json:"total"`
+	Land    int            `json:"land"`
+	Marine  int            `json:"marine"`
+	Regions map[string]int `json:"regions"` // keyed by region, e.g. "CR"
+	Areas   map[string]int `json:"areas"`   // keyed by state or marine area, e.g. "IL"
+	Zones   map[string]int `json:"zones"`   // keyed by zone, e.g. "ILZ014"
+}
+
+// Alert holds the JSON values for a single weather alert.
+type Alert struct {
+	URI           string    `json:"@id"`
+	ID            string    `json:"id"`
+	AreaDesc      string    `json:"areaDesc"`
+	AffectedZones []string  `json:"affectedZones"`
+	Sent          string    `json:"sent"`
+	Effective     string    `json:"effective"`
+	Onset         string    `json:"onset"`
+	Expires       string    `json:"expires"`
+	Ends          string    `json:"ends"`
+	Status        string    `json:"status"`
+	MessageType   string    `json:"messageType"`
+	Category      string    `json:"category"`
+	Severity      Severity  `json:"severity"`
+	Certainty     Certainty `json:"certainty"`
+	Urgency       Urgency   `json:"urgency"`
+	Event         string    `json:"event"`
+	Sender        string    `json:"sender"`
+	SenderName    string    `json:"senderName"`
+	Headline      string    `json:"headline"`
+	Description   string    `json:"description"`
+	Instruction   string    `json:"instruction"`
+	Response      string    `json:"response"`
+}
+
+// AlertsResponse holds the JSON values from /alerts/active/area/<area>
+type AlertsResponse struct {
+	Context    json.RawMessage `json:"@context,omitempty"` // JSON-LD context of the response
+	Title      string          `json:"title"`
+	Updated    string          `json:"updated"`
+	Alerts     []Alert         `json:"@graph"`
+	Pagination Pagination      `json:"pagination"`
 }
 
 // StationsResponse holds the JSON values from /points/<lat,lon>/stations
 type StationsResponse struct {
-	Stations []string `json:"observationStations"`
+	Context  json.RawMessage   `json:"@context,omitempty"` // JSON-LD context of the response
+	Stations []string          `json:"observationStations"`
+	Details  []StationResponse `json:"@graph"`
+}
+
+// StationResponse holds the JSON values from /stations/<id>
+type StationResponse struct {
+	Context           json.RawMessage   `json:"@context,omitempty"` // JSON-LD context of the response
+	ID                string            `json:"@id"`
+	StationIdentifier string            `json:"stationIdentifier"`
+	Name              string            `json:"name"`
+	TimeZone          string            `json:"timeZone"`
+	Elevation         QuantitativeValue `json:"elevation"`
+	Geometry          string            `json:"geometry"` // WKT, e.g. POINT(-87.93 41.96)
+	Forecast          string            `json:"forecast"`
+	County            string            `json:"county"`
+	FireWeatherZone   string            `json:"fireWeatherZone"`
+
+	// Distance is the great-circle distance in kilometers from the point
+	// passed to NearestStations. It is not part of the API response.
+	Distance float64 `json:"-"`
+}
+
+// StationsListResponse holds the JSON values from /stations
+type StationsListResponse struct {
+	Context    json.RawMessage   `json:"@context,omitempty"` // JSON-LD context of the response
+	Stations   []StationResponse `json:"@graph"`
+	Pagination Pagination        `json:"pagination"`
+}
+
+// Pagination holds the JSON values for the cursor of a paginated response.
+type Pagination struct {
+	Next string `json:"next"`
+}
+
+// CloudLayerReading holds the JSON values for a cloud layer of an Observation.
+type CloudLayerReading struct {
+	Base   QuantitativeValue `json:"base"`
+	Amount string            `json:"amount"` // METAR code, e.g. FEW, SCT, BKN, OVC
+}
+
+// Observation holds the JSON values for a single observation from a station.
+type Observation struct {
+	Context               json.RawMessage     `json:"@context,omitempty"` // JSON-LD context of the response
+	ID                    string              `json:"@id"`
+	Elevation             QuantitativeValue   `json:"elevation"`
+	Station               string              `json:"station"`
+	Timestamp             string              `json:"timestamp"`
+	RawMessage            string              `json:"rawMessage"`
+	TextDescription       string              `json:"textDescription"`
+	Icon                  string              `json:"icon"`
+	Temperature           QuantitativeValue   `json:"temperature"`
+	Dewpoint              QuantitativeValue   `json:"dewpoint"`
+	WindDirection         QuantitativeValue   `json:"windDirection"`
+	WindSpeed             QuantitativeValue   `json:"windSpeed"`
+	WindGust              QuantitativeValue   `json:"windGust"`
+	BarometricPressure    QuantitativeValue   `json:"barometricPressure"`
+	SeaLevelPressure      QuantitativeValue   `json:"seaLevelPressure"`
+	Visibility            QuantitativeValue   `json:"visibility"`
+	PrecipitationLastHour QuantitativeValue   `json:"precipitationLastHour"`
+	RelativeHumidity      QuantitativeValue   `json:"relativeHumidity"`
+	WindChill             QuantitativeValue   `json:"windChill"`
+	HeatIndex             QuantitativeValue   `json:"heatIndex"`
+	CloudLayers           []CloudLayerReading `json:"cloudLayers"`
+}
+
+// ObservationsResponse holds the JSON values from /stations/<id>/observations
+type ObservationsResponse struct {
+	Context      json.RawMessage `json:"@context,omitempty"` // JSON-LD context of the response
+	Observations []Observation   `json:"@graph"`
+	Pagination   Pagination      `json:"pagination"`
 }
 
 // ForecastElevation holds the JSON values for a forecast response's elevation.
@@ -66,6 +365,26 @@ type ForecastElevation struct {
 	Units string  `json:"unitCode"`
 }
 
+// UnmarshalJSON decodes a forecast elevation from either an object with a
+// value and unit code or a bare number (or numeric string) without a unit.
+func (e *ForecastElevation) UnmarshalJSON(data []byte) error {
+	if value, ok, err := bareNumber(data); ok || err != nil {
+		e.Value = value
+		return err
+	}
+	type forecastElevation ForecastElevation
+	return json.Unmarshal(data, (*forecastElevation)(e))
+}
+
+// Meters returns the elevation in meters. Elevations without a unit code are
+// assumed to be in meters already.
+func (e ForecastElevation) Meters() float64 {
+	if f, ok := conversions[[2]string{e.Units, unitM}]; ok {
+		return f(e.Value)
+	}
+	return e.Value
+}
+
 // ForecastResponsePeriod holds the JSON values for a period within a forecast response.
 type ForecastResponsePeriod struct {
 	ID               int32   `json:"number"`
@@ -73,10 +392,11 @@ type ForecastResponsePeriod struct {
 	StartTime        string  `json:"startTime"`
 	EndTime          string  `json:"endTime"`
 	IsDaytime        bool    `json:"isDaytime"`
-	Temperature      float64 // preserved for legacy compatibility, may be deprecated in the future
-	TemperatureUnit  string  // preserved for legacy compatibility, may be deprecated in the future
+	Temperature      float64 // legacy "temperature", see UnmarshalJSON
+	TemperatureUnit  string  `json:"temperatureUnit"`
 	TemperatureTrend string  `json:"temperatureTrend"`
-	WindSpeed        string  // preserved for legacy compatibility, may be deprecated in the future
+	WindSpeed        string  // legacy "windSpeed", see UnmarshalJSON
+	WindGust         string  `json:"-"` // from QuantitativeWindGust, empty if none
 	WindDirection    string  `json:"windDirection"`
 	Icon             string  `json:"icon"`
 	Summary          string  `json:"shortForecast"`
@@ -90,16 +410,74 @@ type ForecastResponsePeriod struct {
 	QuantitativeWindGust         QuantitativeValue `json:"windGust"`
 }
 
+// UnmarshalJSON decodes a forecast period in either of the shapes returned by
+// the API. With QV enabled "temperature" and "windSpeed" are objects and are
+// decoded into the Quantitative* fields. Otherwise they are the legacy number
+// and string values which are decoded into Temperature and WindSpeed.
+func (p *ForecastResponsePeriod) UnmarshalJSON(data []byte) error {
+	type period ForecastResponsePeriod
+	aux := struct {
+		*period
+		Temperature json.RawMessage `json:"temperature"`
+		WindSpeed   json.RawMessage `json:"windSpeed"`
+	}{period: (*period)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if err := unmarshalLegacyOrQV(aux.Temperature, &p.Temperature, &p.QuantitativeTemperature); err != nil {
+		return err
+	}
+	return unmarshalLegacyOrQV(aux.WindSpeed, &p.WindSpeed, &p.QuantitativeWindSpeed)
+}
+
+// unmarshalLegacyOrQV decodes data into qv when it is a JSON object and into
+// legacy otherwise. Missing values are left untouched.
+func unmarshalLegacyOrQV(data json.RawMessage, legacy any, qv *QuantitativeValue) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if data[0] == '{' {
+		return json.Unmarshal(data, qv)
+	}
+	return json.Unmarshal(data, legacy)
+}
+
 // ForecastResponsePeriodHourly provides the JSON value for a period within an hourly forecast.
 type ForecastResponsePeriodHourly = ForecastResponsePeriod
 
 // ForecastResponse holds the JSON values from /gridpoints/<cwa>/<x,y>/forecast"
 type ForecastResponse struct {
-	Updated   string                   `json:"updated"`
-	Units     string                   `json:"units"`
-	Elevation ForecastElevation        `json:"elevation"`
-	Periods   []ForecastResponsePeriod `json:"periods"`
-	Point     *PointsResponse
+	Context           json.RawMessage          `json:"@context,omitempty"` // JSON-LD context of the response
+	ForecastGenerator string                   `json:"forecastGenerator"`
+	GeneratedAt       string                   `json:"generatedAt"`
+	Updated           string                   `json:"updated"`
+	Units             string                   `json:"units"`
+	Elevation         ForecastElevation        `json:"elevation"`
+	Periods           []ForecastResponsePeriod `json:"periods"`
+	Point             *PointsResponse
+}
+
+// ZoneForecastPeriod holds the JSON values for a period within a zone forecast.
+type ZoneForecastPeriod struct {
+	ID      int32  `json:"number"`
+	Name    string `json:"name"`
+	Details string `json:"detailedForecast"`
+}
+
+// ZoneForecastResponse holds the JSON values from /zones/<type>/<id>/forecast
+type ZoneForecastResponse struct {
+	Context json.RawMessage      `json:"@context,omitempty"` // JSON-LD context of the response
+	Zone    string               `json:"zone"`
+	Updated string               `json:"updated"`
+	Periods []ZoneForecastPeriod `json:"periods"`
+}
+
+// FullForecastResponse holds both the forecast and the hourly forecast for the
+// same point. See FullForecast.
+type FullForecastResponse struct {
+	Forecast *ForecastResponse
+	Hourly   *HourlyForecastResponse
+	Point    *PointsResponse
 }
 
 // WeatherValueItem holds the JSON values for a weather.values[x].value.
@@ -142,6 +520,7 @@ type Hazard struct {
 
 // HourlyForecastResponse holds the JSON values for the hourly forecast.
 type HourlyForecastResponse struct {
+	Context           json.RawMessage                `json:"@context,omitempty"` // JSON-LD context of the response
 	Updated           string                         `json:"updated"`
 	Units             string                         `json:"units"`
 	ForecastGenerator string                         `json:"forecastGenerator"`
@@ -155,6 +534,7 @@ type HourlyForecastResponse struct {
 // GridpointForecastResponse holds the JSON values from /gridpoints/<cwa>/<x,y>"
 // See https://weather-gov.github.io/api/gridpoints for information.
 type GridpointForecastResponse struct {
+	Context                          json.RawMessage             `json:"@context,omitempty"` // JSON-LD context of the response
 	Updated                          string                      `json:"updateTime"`
 	Elevation                        ForecastElevation           `json:"elevation"`
 	Weather                          Weather                     `json:"weather"`
@@ -0,0 +1,114 @@
+package noaa
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// unitSymbols maps the WMO unit codes used by the API to display symbols. The
+// symbols of units that are written with a space between the value and unit
+// include the leading space.
+var unitSymbols = map[string]string{
+	"wmoUnit:degC":           "°C",
+	"wmoUnit:degF":           "°F",
+	"wmoUnit:K":              " K",
+	"wmoUnit:degree_(angle)": "°",
+	"wmoUnit:percent":        "%",
+	"wmoUnit:km_h-1":         " km/h",
+	"wmoUnit:m_s-1":          " m/s",
+	"wmoUnit:mi_h-1":         " mph",
+	"wmoUnit:kt":             " kt",
+	"wmoUnit:Pa":             " Pa",
+	"wmoUnit:hPa":            " hPa",
+	"wmoUnit:mm":             " mm",
+	"wmoUnit:cm":             " cm",
+	"wmoUnit:m":              " m",
+	"wmoUnit:km":             " km",
+	"wmoUnit:in":             " in",
+	"wmoUnit:ft":             " ft",
+	"wmoUnit:mi":             " mi",
+	"wmoUnit:in_Hg":          " inHg",
+}
+
+// WMO unit codes used by the API. The US customary codes are the codes used by
+// this client for converted values.
+const (
+	unitDegC = "wmoUnit:degC"
+	unitDegF = "wmoUnit:degF"
+	unitK    = "wmoUnit:K"
+	unitKmh  = "wmoUnit:km_h-1"
+	unitMs   = "wmoUnit:m_s-1"
+	unitMph  = "wmoUnit:mi_h-1"
+	unitPa   = "wmoUnit:Pa"
+	unitHPa  = "wmoUnit:hPa"
+	unitInHg = "wmoUnit:in_Hg"
+	unitM    = "wmoUnit:m"
+	unitKm   = "wmoUnit:km"
+	unitMi   = "wmoUnit:mi"
+	unitFt   = "wmoUnit:ft"
+	unitMm   = "wmoUnit:mm"
+	unitIn   = "wmoUnit:in"
+)
+
+// PascalsPerInchOfMercury converts pressures between Pa and inHg.
+const PascalsPerInchOfMercury = 3386.389
+
+// conversions holds the functions that convert values between unit codes.
+var conversions = map[[2]string]func(float64) float64{
+	{unitDegC, unitDegF}: func(v float64) float64 { return v*9/5 + 32 },
+	{unitDegF, unitDegC}: func(v float64) float64 { return (v - 32) * 5 / 9 },
+	{unitK, unitDegC}:    func(v float64) float64 { return v - 273.15 },
+	{unitK, unitDegF}:    func(v float64) float64 { return (v-273.15)*9/5 + 32 },
+	{unitKmh, unitMph}:   func(v float64) float64 { return v * MilesPerKilometer },
+	{unitMs, unitMph}:    func(v float64) float64 { return v * 3.6 * MilesPerKilometer },
+	{unitMph, unitKmh}:   func(v float64) float64 { return v * KilometersPerMile },
+	{unitMs, unitKmh}:    func(v float64) float64 { return v * 3.6 },
+	{unitPa, unitInHg}:   func(v float64) float64 { return v / PascalsPerInchOfMercury },
+	{unitHPa, unitInHg}:  func(v float64) float64 { return v * 100 / PascalsPerInchOfMercury },
+	{unitInHg, unitPa}:   func(v float64) float64 { return v * PascalsPerInchOfMercury },
+	{unitHPa, unitPa}:    func(v float64) float64 { return v * 100 },
+	{unitM, unitMi}:      func(v float64) float64 { return v / 1609.344 },
+	{unitKm, unitMi}:     func(v float64) float64 { return v * MilesPerKilometer },
+	{unitMi, unitM}:      func(v float64) float64 { return v * 1609.344 },
+	{unitFt, unitM}:      func(v float64) float64 { return v * 0.3048 },
+	{unitMm, unitIn}:     func(v float64) float64 { return v / 25.4 },
+	{unitIn, unitMm}:     func(v float64) float64 { return v * 25.4 },
+}
+
+// convert returns q converted to the unit code to. Only the values that are
+// present are converted, see HasValue, so that a missing value stays missing
+// instead of becoming e.g. 32°F. Values in units that have no known conversion
+// are returned unchanged.
+func convert(q QuantitativeValue, to string) QuantitativeValue {
+	f, ok := conversions[[2]string{q.UnitCode, to}]
+	if !ok {
+		return q
+	}
+	if q.has(hasValue, q.Value) {
+		q.Value = f(q.Value)
+	}
+	if q.has(hasMinValue, q.MinValue) {
+		q.MinValue = f(q.MinValue)
+	}
+	if q.has(hasMaxValue, q.MaxValue) {
+		q.MaxValue = f(q.MaxValue)
+	}
+	q.UnitCode = to
+	return q
+}
+
+// String returns the value followed by a human readable unit derived from the
+// unit code, for example "72°F", "22 km/h", or "1013 hPa". Pressures in Pa are
+// shown in hPa. Unknown unit codes are shown without the "wmoUnit:" prefix.
+func (q QuantitativeValue) String() string {
+	value, unitCode := q.Value, q.UnitCode
+	if unitCode == "wmoUnit:Pa" {
+		value, unitCode = value/100, "wmoUnit:hPa"
+	}
+	symbol, ok := unitSymbols[unitCode]
+	if !ok && unitCode != "" {
+		symbol = " " + strings.TrimPrefix(unitCode, "wmoUnit:")
+	}
+	return strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64) + symbol
+}
@@ -0,0 +1,175 @@
+package noaa
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Errors returned when resolving a ZIP code to a location.
+var (
+	ErrInvalidZip = errors.New("invalid ZIP code")
+	ErrUnknownZip = errors.New("unknown ZIP code")
+)
+
+// The bundled ZIP code centroids in the CSV format read by LoadZipCodes, meant
+// to hold the centroid of every ZIP Code Tabulation Area in the Census Bureau's
+// ZCTA gazetteer file. The checked-in table is incomplete and only covers the
+// downtown ZIP codes of large US cities, so run go generate to download the
+// gazetteer file and rebuild it, see gen_zipcodes.go. Until then use
+// LoadZipCodes for other ZIP codes.
+//
+//go:generate go run gen_zipcodes.go -o zipcodes.csv https://www2.census.gov/geo/docs/maps-data/data/gazetteer/2020_Gazetteer/2020_Gaz_zcta_national.zip
+//go:embed zipcodes.csv
+var bundledZipCSV string
+
+var (
+	zipMu        sync.RWMutex            // guards zipCentroids
+	zipCentroids = map[string]Location{} // registered centroids, keyed by five digit ZIP code
+
+	bundledZipOnce sync.Once
+	bundledZips    map[string]Location // parsed from bundledZipCSV on first use
+	bundledZipErr  error
+)
+
+// RegisterZipCode adds the centroid of a five digit ZIP code to the table used
+// by ForecastByZip. Registered centroids take precedence over the bundled ones
+// and replace the centroid of the ZIP code if it was registered before.
+func RegisterZipCode(zip string, lat string, lon string) error {
+	code, location, err := zipLocation(zip, lat, lon)
+	if err != nil {
+		return err
+	}
+	zipMu.Lock()
+	defer zipMu.Unlock()
+	zipCentroids[code] = location
+	return nil
+}
+
+// zipLocation validates a ZIP code and the coordinates of its centroid.
+func zipLocation(zip string, lat string, lon string) (string, Location, error) {
+	code, err := zipCode(zip)
+	if err != nil {
+		return "", Location{}, err
+	}
+	for _, coordinate := range []string{lat, lon} {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(coordinate), 64); err != nil {
+			return "", Location{}, fmt.Errorf("invalid coordinate %q for ZIP code %s: %w", coordinate, code, err)
+		}
+	}
+	return code, Location{Lat: strings.TrimSpace(lat), Lon: strings.TrimSpace(lon)}, nil
+}
+
+// LoadZipCodes registers the ZIP code centroids read from r as CSV records of
+// ZIP code, latitude, and longitude, for example "60629,41.7753,-87.7116". A
+// header row is skipped. Sources such as the Census Bureau's ZCTA gazetteer
+// file can be converted to this format, see gen_zipcodes.go. See
+// RegisterZipCode.
+func LoadZipCodes(r io.Reader) error {
+	return readZipCodes(r, RegisterZipCode)
+}
+
+// readZipCodes calls register for every record of the ZIP code CSV read from r,
+// see LoadZipCodes.
+func readZipCodes(r io.Reader, register func(zip string, lat string, lon string) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == 1 {
+			if _, err := zipCode(record[0]); err != nil {
+				continue // header
+			}
+		}
+		if err := register(record[0], record[1], record[2]); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// ForecastByZip returns the forecast for the centroid of a US ZIP code, e.g.
+// "60629" or "60629-1234", see Forecast. The API has no geocoding so the
+// centroid is looked up in the ZIP codes added with RegisterZipCode or
+// LoadZipCodes and then in the bundled table. ErrUnknownZip is returned for ZIP
+// codes that are in neither and ErrInvalidZip for strings that are not ZIP
+// codes.
+func ForecastByZip(zip string, opts ...Option) (forecast *ForecastResponse, err error) {
+	code, err := zipCode(zip)
+	if err != nil {
+		return nil, err
+	}
+	location, ok, err := lookupZip(code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownZip, code)
+	}
+	return Forecast(location.Lat, location.Lon, opts...)
+}
+
+// lookupZip returns the registered or else the bundled centroid of a five digit
+// ZIP code. The bundled table is parsed on first use.
+func lookupZip(code string) (Location, bool, error) {
+	zipMu.RLock()
+	location, ok := zipCentroids[code]
+	zipMu.RUnlock()
+	if ok {
+		return location, true, nil
+	}
+	bundledZipOnce.Do(func() {
+		bundledZips = map[string]Location{}
+		bundledZipErr = readZipCodes(strings.NewReader(bundledZipCSV), func(zip string, lat string, lon string) error {
+			code, location, err := zipLocation(zip, lat, lon)
+			if err == nil {
+				bundledZips[code] = location
+			}
+			return err
+		})
+	})
+	if bundledZipErr != nil {
+		return Location{}, false, fmt.Errorf("bundled ZIP codes: %w", bundledZipErr)
+	}
+	location, ok = bundledZips[code]
+	return location, ok, nil
+}
+
+// resetZipCodes forgets the registered ZIP codes, e.g. between tests.
+func resetZipCodes() {
+	zipMu.Lock()
+	defer zipMu.Unlock()
+	zipCentroids = map[string]Location{}
+}
+
+// zipCode returns the five digit ZIP code of a ZIP or ZIP+4 code.
+func zipCode(zip string) (string, error) {
+	code := strings.TrimSpace(zip)
+	if len(code) == 10 && code[5] == '-' && isDigits(code[6:]) {
+		code = code[:5]
+	}
+	if len(code) != 5 || !isDigits(code) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidZip, zip)
+	}
+	return code, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}